@@ -0,0 +1,183 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+)
+
+type CleanupCommand struct {
+	OlderThan   time.Duration `name:"older-than" env:"CLEANUP_OLDER_THAN" help:"Only delete exports created more than this long ago (e.g. '24h')"`
+	State       []string      `name:"state" env:"CLEANUP_STATE" enum:"creating,uploading,complete,error,expired" help:"Only delete exports in these states (can be repeated)"`
+	CreatedByMe bool          `name:"created-by-me" env:"CLEANUP_CREATED_BY_ME" help:"Only delete exports created by the user the token belongs to"`
+	DryRun      bool          `name:"dry-run" env:"CLEANUP_DRY_RUN" help:"List the exports which would be deleted, without deleting them"`
+}
+
+// cleanupFilter selects the file operations which should be deleted by the
+// cleanup command.
+type cleanupFilter struct {
+	before  time.Time
+	formats []api.ExportFormat
+	states  []api.FileOperationState
+	userID  string
+}
+
+// matches returns true if the file operation is selected by the filter.
+func (f *cleanupFilter) matches(op *api.FileOperation) bool {
+	if op.Type != api.FileOperationTypeExport {
+		return false
+	}
+
+	if !f.before.IsZero() && !op.CreatedAt.Before(f.before) {
+		return false
+	}
+
+	if len(f.formats) > 0 && !slices.Contains(f.formats, op.Format) {
+		return false
+	}
+
+	if len(f.states) > 0 && !slices.Contains(f.states, op.State) {
+		return false
+	}
+
+	if f.userID != "" && (op.User == nil || op.User.ID != f.userID) {
+		return false
+	}
+
+	return true
+}
+
+// newCleanupFilter returns the filter based on the cleanup flags (and --format).
+// Only flags and environment variables are used, so the formats of jobs from the
+// config file never become selectors. The user of --created-by-me is resolved
+// per instance.
+func newCleanupFilter() (*cleanupFilter, error) {
+	flags := cli.Flags.Cleanup
+
+	if flags.OlderThan == 0 && len(flags.State) == 0 && !flags.CreatedByMe && len(cli.Flags.Format) == 0 {
+		return nil, errors.New("at least one of --older-than, --format, --state, or --created-by-me is required")
+	}
+
+	filter := &cleanupFilter{}
+
+	if flags.OlderThan > 0 {
+		filter.before = time.Now().Add(-flags.OlderThan)
+	}
+
+	for _, name := range cli.Flags.Format {
+		format, ok := exportFormats[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid format: %q", name)
+		}
+		filter.formats = append(filter.formats, format)
+	}
+
+	for _, state := range flags.State {
+		filter.states = append(filter.states, api.FileOperationState(state))
+	}
+
+	return filter, nil
+}
+
+// runCleanup deletes the export file operations selected by the cleanup flags,
+// for each Outline instance of the provided jobs. At least one selector is
+// required, so all exports aren't deleted by accident.
+func runCleanup(ctx context.Context, logger *slog.Logger, jobs []*exportJob) error {
+	filter, err := newCleanupFilter()
+	if err != nil {
+		return err
+	}
+
+	// The filter is the same for all jobs, so each instance only needs to be
+	// cleaned up once.
+	seen := make(map[string]bool, len(jobs))
+	var errs []error
+
+	for _, job := range jobs {
+		key := strings.Join([]string{job.flags.URL, job.flags.Token, job.flags.TokenFile, job.flags.TokenCommand}, "\x00")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if err := cleanupInstance(ctx, logger, job, *filter); err != nil {
+			if job.name != "" {
+				err = fmt.Errorf("job %q: %w", job.name, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// cleanupInstance deletes the export file operations of a single Outline
+// instance which are selected by the filter.
+func cleanupInstance(ctx context.Context, logger *slog.Logger, job *exportJob, filter cleanupFilter) error {
+	base := cli.Flags
+	cli.Flags = job.flags
+	defer func() { cli.Flags = base }()
+
+	flags := cli.Flags.Cleanup
+
+	client, err := newClient(ctx, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+
+	if flags.CreatedByMe {
+		info, err := client.AuthInfo(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to fetch token user: %w", err)
+		}
+		filter.userID = info.User.ID
+	}
+
+	// Collect all matches before deleting, as deleting while paginating would
+	// shift the offsets.
+	var selected []*api.FileOperation
+	for op, err := range client.ListFileOperations(ctx) {
+		if err != nil {
+			return fmt.Errorf("failed to list file operations: %w", err)
+		}
+
+		if filter.matches(op) {
+			selected = append(selected, op)
+		}
+	}
+
+	var deleted int
+	for _, op := range selected {
+		attrs := []any{
+			"id", op.ID,
+			"name", op.Name,
+			"format", op.Format,
+			"state", op.State,
+			"created_at", op.CreatedAt.Format(time.RFC3339),
+		}
+
+		if flags.DryRun {
+			logger.InfoContext(ctx, "would delete export (dry run)", attrs...)
+			continue
+		}
+
+		if err = client.DeleteFileOperation(ctx, op.ID); err != nil {
+			return fmt.Errorf("failed to delete export %q: %w", op.ID, err)
+		}
+		deleted++
+		logger.InfoContext(ctx, "deleted export", attrs...)
+	}
+
+	logger.InfoContext(ctx, "cleanup completed", "matched", len(selected), "deleted", deleted, "dry_run", flags.DryRun)
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+)
+
+func TestCleanupFilterMatches(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	op := &api.FileOperation{
+		ID:        "op1",
+		Type:      api.FileOperationTypeExport,
+		Format:    api.ExportFormatMarkdown,
+		State:     api.FileOperationStateComplete,
+		User:      &api.User{ID: "u1"},
+		CreatedAt: now.Add(-2 * time.Hour),
+	}
+
+	tests := []struct {
+		name   string
+		filter *cleanupFilter
+		op     *api.FileOperation
+		want   bool
+	}{
+		{name: "empty", filter: &cleanupFilter{}, op: op, want: true},
+		{name: "not-export", filter: &cleanupFilter{}, op: &api.FileOperation{Type: "import"}},
+		{name: "older", filter: &cleanupFilter{before: now.Add(-time.Hour)}, op: op, want: true},
+		{name: "newer", filter: &cleanupFilter{before: now.Add(-3 * time.Hour)}, op: op},
+		{name: "format", filter: &cleanupFilter{formats: []api.ExportFormat{api.ExportFormatJSON, api.ExportFormatMarkdown}}, op: op, want: true},
+		{name: "other-format", filter: &cleanupFilter{formats: []api.ExportFormat{api.ExportFormatJSON}}, op: op},
+		{name: "state", filter: &cleanupFilter{states: []api.FileOperationState{api.FileOperationStateComplete}}, op: op, want: true},
+		{name: "other-state", filter: &cleanupFilter{states: []api.FileOperationState{api.FileOperationStateError}}, op: op},
+		{name: "user", filter: &cleanupFilter{userID: "u1"}, op: op, want: true},
+		{name: "other-user", filter: &cleanupFilter{userID: "u2"}, op: op},
+		{name: "no-user", filter: &cleanupFilter{userID: "u1"}, op: &api.FileOperation{Type: api.FileOperationTypeExport}},
+		{
+			name: "all",
+			filter: &cleanupFilter{
+				before:  now.Add(-time.Hour),
+				formats: []api.ExportFormat{api.ExportFormatMarkdown},
+				states:  []api.FileOperationState{api.FileOperationStateComplete},
+				userID:  "u1",
+			},
+			op:   op,
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.filter.matches(tt.op); got != tt.want {
+				t.Errorf("matches(%+v) = %t, want %t", tt.op, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCleanupFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantBefore  time.Duration // Age of the before cutoff, or 0 if unset.
+		wantFormats []api.ExportFormat
+		wantStates  []api.FileOperationState
+		wantErr     string
+	}{
+		{name: "older-than", args: []string{"--older-than", "24h"}, wantBefore: 24 * time.Hour},
+		{
+			name:        "format",
+			args:        []string{"--format", "markdown,json"},
+			wantFormats: []api.ExportFormat{api.ExportFormatMarkdown, api.ExportFormatJSON},
+		},
+		{
+			name:       "state",
+			args:       []string{"--state", "error", "--state", "expired"},
+			wantStates: []api.FileOperationState{api.FileOperationStateError, api.FileOperationStateExpired},
+		},
+		{name: "created-by-me", args: []string{"--created-by-me"}},
+		{name: "dry-run-only", args: []string{"--dry-run"}, wantErr: "at least one of"},
+		{name: "invalid-format", args: []string{"--format", "pdf"}, wantErr: `invalid format: "pdf"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, append([]string{"cleanup"}, tt.args...)...)
+
+			filter, err := newCleanupFilter()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newCleanupFilter() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("newCleanupFilter() error = %v", err)
+			}
+
+			if tt.wantBefore == 0 {
+				if !filter.before.IsZero() {
+					t.Errorf("newCleanupFilter() before = %v, want unset", filter.before)
+				}
+			} else if age := time.Since(filter.before); age < tt.wantBefore || age > tt.wantBefore+time.Minute {
+				t.Errorf("newCleanupFilter() before = %v ago, want %v ago", age, tt.wantBefore)
+			}
+
+			if !slices.Equal(filter.formats, tt.wantFormats) || !slices.Equal(filter.states, tt.wantStates) {
+				t.Errorf("newCleanupFilter() = %+v, want formats %q and states %q", filter, tt.wantFormats, tt.wantStates)
+			}
+
+			// The user is resolved per instance.
+			if filter.userID != "" {
+				t.Errorf("newCleanupFilter() user = %q, want unset", filter.userID)
+			}
+		})
+	}
+}
+
+func TestRunCleanup(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour)
+
+	tests := []struct {
+		name string
+		args []string
+		want []string // IDs of the deleted exports.
+	}{
+		{name: "older-than", args: []string{"--older-than", "24h"}, want: []string{"old-mine", "old-other"}},
+		{name: "created-by-me", args: []string{"--created-by-me"}, want: []string{"old-mine", "new-mine"}},
+		{name: "combined", args: []string{"--older-than", "24h", "--created-by-me", "--state", "complete"}, want: []string{"old-mine"}},
+		{name: "dry-run", args: []string{"--older-than", "24h", "--dry-run"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var deleted []string
+
+			srv := newTestServer(t, map[string]func(body map[string]any) any{
+				"/auth.info": func(map[string]any) any {
+					return map[string]any{"data": map[string]any{"user": map[string]any{"id": "me"}}}
+				},
+				"/fileOperations.list": func(map[string]any) any {
+					return map[string]any{"data": []map[string]any{
+						{"id": "old-mine", "type": "export", "state": "complete", "user": map[string]any{"id": "me"}, "createdAt": old},
+						{"id": "old-other", "type": "export", "state": "error", "user": map[string]any{"id": "other"}, "createdAt": old},
+						{"id": "new-mine", "type": "export", "state": "complete", "user": map[string]any{"id": "me"}, "createdAt": time.Now()},
+						{"id": "import", "type": "import", "state": "complete", "user": map[string]any{"id": "me"}, "createdAt": old},
+					}}
+				},
+				"/fileOperations.delete": func(body map[string]any) any {
+					mu.Lock()
+					defer mu.Unlock()
+
+					deleted = append(deleted, body["id"].(string))
+					return map[string]any{"success": true}
+				},
+			})
+
+			flags := setFlags(t, append([]string{"cleanup", "--url", srv.URL, "--token", "tok"}, tt.args...)...)
+
+			// Jobs for the same instance are only cleaned up once.
+			jobs := []*exportJob{{name: "wiki/nightly", flags: flags}, {name: "wiki/all", flags: flags}}
+
+			if err := runCleanup(t.Context(), slog.New(slog.DiscardHandler), jobs); err != nil {
+				t.Fatalf("runCleanup() error = %v", err)
+			}
+
+			if !slices.Equal(deleted, tt.want) {
+				t.Errorf("runCleanup() deleted %q, want %q", deleted, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,513 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lrstanley/outline-export/internal/sanitize"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is the configuration file (see --config), which defines one or more
+// Outline instances, each with one or more export jobs. Field names match the
+// equivalent flags.
+type Config struct {
+	Instances []*InstanceConfig `yaml:"instances" toml:"instances"`
+}
+
+// InstanceConfig is a single Outline instance.
+type InstanceConfig struct {
+	Name string `yaml:"name" toml:"name"`
+	URL  string `yaml:"url"  toml:"url"`
+
+	// Token, TokenEnv, TokenFile and TokenCommand are the sources the token can
+	// be read from. Only one can be provided.
+	Token        string `yaml:"token"         toml:"token"`
+	TokenEnv     string `yaml:"token-env"     toml:"token-env"`
+	TokenFile    string `yaml:"token-file"    toml:"token-file"`
+	TokenCommand string `yaml:"token-command" toml:"token-command"`
+
+	HTTPTimeout      *time.Duration `yaml:"http-timeout"       toml:"http-timeout"`
+	RewriteRedirect  *bool          `yaml:"rewrite-redirect"   toml:"rewrite-redirect"`
+	RetryMaxAttempts *int           `yaml:"retry-max-attempts" toml:"retry-max-attempts"`
+	RetryBaseDelay   *time.Duration `yaml:"retry-base-delay"   toml:"retry-base-delay"`
+	RetryMaxDelay    *time.Duration `yaml:"retry-max-delay"    toml:"retry-max-delay"`
+	RetryMaxAfter    *time.Duration `yaml:"retry-max-after"    toml:"retry-max-after"`
+
+	CAFile             *string `yaml:"ca-file"              toml:"ca-file"`
+	ClientCert         *string `yaml:"client-cert"          toml:"client-cert"`
+	ClientKey          *string `yaml:"client-key"           toml:"client-key"`
+	TLSMinVersion      *string `yaml:"tls-min-version"      toml:"tls-min-version"`
+	ProxyURL           *string `yaml:"proxy-url"            toml:"proxy-url"`
+	InsecureSkipVerify *bool   `yaml:"insecure-skip-verify" toml:"insecure-skip-verify"`
+
+	Jobs []*JobConfig `yaml:"jobs" toml:"jobs"`
+}
+
+// JobConfig is a single export job of an instance.
+type JobConfig struct {
+	Name string `yaml:"name" toml:"name"`
+
+	Mode               *string    `yaml:"mode"                toml:"mode"`
+	Concurrency        *int       `yaml:"concurrency"         toml:"concurrency"`
+	Format             stringList `yaml:"format"              toml:"format"`
+	ExcludeAttachments *bool      `yaml:"exclude-attachments" toml:"exclude-attachments"`
+	ExcludePrivate     *bool      `yaml:"exclude-private"     toml:"exclude-private"`
+	Extract            *bool      `yaml:"extract"             toml:"extract"`
+	Mirror             *bool      `yaml:"mirror"              toml:"mirror"`
+	ExportPath         *string    `yaml:"export-path"         toml:"export-path"`
+	Collections        []string   `yaml:"collections"         toml:"collections"`
+	Filters            []string   `yaml:"filters"             toml:"filters"`
+	Include            []string   `yaml:"include"             toml:"include"`
+	Exclude            []string   `yaml:"exclude"             toml:"exclude"`
+	IncludeCollections []string   `yaml:"include-collections" toml:"include-collections"`
+	ExcludeCollections []string   `yaml:"exclude-collections" toml:"exclude-collections"`
+	Sanitize           *string    `yaml:"sanitize"            toml:"sanitize"`
+
+	MaxExtractSize      *byteSize `yaml:"max-extract-size"      toml:"max-extract-size"`
+	MaxExtractFiles     *int      `yaml:"max-extract-files"     toml:"max-extract-files"`
+	MaxCompressionRatio *int      `yaml:"max-compression-ratio" toml:"max-compression-ratio"`
+
+	Reuse          *string        `yaml:"reuse"            toml:"reuse"`
+	ReuseMaxAge    *time.Duration `yaml:"reuse-max-age"    toml:"reuse-max-age"`
+	ReuseStateFile *string        `yaml:"reuse-state-file" toml:"reuse-state-file"`
+
+	FileMode *fileMode `yaml:"file-mode" toml:"file-mode"`
+	DirMode  *fileMode `yaml:"dir-mode"  toml:"dir-mode"`
+	UID      *int      `yaml:"uid"       toml:"uid"`
+	GID      *int      `yaml:"gid"       toml:"gid"`
+
+	Snapshot    *bool `yaml:"snapshot"     toml:"snapshot"`
+	KeepLast    *int  `yaml:"keep-last"    toml:"keep-last"`
+	KeepDaily   *int  `yaml:"keep-daily"   toml:"keep-daily"`
+	KeepWeekly  *int  `yaml:"keep-weekly"  toml:"keep-weekly"`
+	KeepMonthly *int  `yaml:"keep-monthly" toml:"keep-monthly"`
+
+	Git            *bool   `yaml:"git"              toml:"git"`
+	GitBranch      *string `yaml:"git-branch"       toml:"git-branch"`
+	GitAuthorName  *string `yaml:"git-author-name"  toml:"git-author-name"`
+	GitAuthorEmail *string `yaml:"git-author-email" toml:"git-author-email"`
+	GitPushRemote  *string `yaml:"git-push-remote"  toml:"git-push-remote"`
+}
+
+// stringList is a list of strings, which can also be provided as a single string
+// in the config file (e.g. `format: markdown` or `format: [markdown, json]`).
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+
+	var v []string
+	if err := node.Decode(&v); err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+func (l *stringList) UnmarshalTOML(data any) error {
+	switch v := data.(type) {
+	case string:
+		*l = stringList{v}
+	case []any:
+		*l = make(stringList, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected string, got %T", item)
+			}
+			*l = append(*l, s)
+		}
+	default:
+		return fmt.Errorf("expected string or list of strings, got %T", data)
+	}
+	return nil
+}
+
+// exportJob is a single export job, with the flags it should run with.
+type exportJob struct {
+	name  string
+	flags *Flags
+}
+
+// loadConfig loads the configuration file at path. The format is based on the
+// file extension (.yaml, .yml, or .toml). Unknown fields are rejected.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %q: %w", path, err)
+	}
+
+	config := &Config{}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(config); err != nil {
+			return nil, fmt.Errorf("failed to parse config %q: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config %q: %w", path, err)
+		}
+
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("failed to parse config %q: unknown field %q", path, undecoded[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (expected .yaml, .yml, or .toml)", ext)
+	}
+
+	if len(config.Instances) == 0 {
+		return nil, fmt.Errorf("config %q: no instances defined", path)
+	}
+
+	names := make(map[string]bool)
+	for i, instance := range config.Instances {
+		if instance.Name == "" {
+			return nil, fmt.Errorf("config %q: instance %d: name is required", path, i+1)
+		}
+
+		if len(instance.Jobs) == 0 {
+			return nil, fmt.Errorf("config %q: instance %q: no jobs defined", path, instance.Name)
+		}
+
+		for j, job := range instance.Jobs {
+			if job.Name == "" {
+				return nil, fmt.Errorf("config %q: instance %q: job %d: name is required", path, instance.Name, j+1)
+			}
+
+			name := instance.Name + "/" + job.Name
+			if names[name] {
+				return nil, fmt.Errorf("config %q: duplicate job %q", path, name)
+			}
+			names[name] = true
+		}
+	}
+
+	return config, nil
+}
+
+// resolveJobs returns the export jobs which should be run. Without --config, a
+// single job is returned, using the flags as-is. Otherwise, each job selected
+// with --job (or all jobs, if none are selected) is returned, with values from
+// the config file applied to any flags which weren't explicitly set (through the
+// command line or environment variables). If export is false, only the flags
+// needed to connect to Outline are validated.
+func resolveJobs(export bool) ([]*exportJob, error) {
+	if cli.Flags.Config == "" {
+		if len(cli.Flags.Jobs) > 0 {
+			return nil, errors.New("--job requires --config")
+		}
+
+		if err := cli.Flags.validate(export); err != nil {
+			return nil, err
+		}
+		return []*exportJob{{flags: cli.Flags}}, nil
+	}
+
+	config, err := loadConfig(cli.Flags.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	explicit := explicitFlags()
+
+	var jobs []*exportJob
+	matched := make(map[string]bool, len(cli.Flags.Jobs))
+
+	for _, instance := range config.Instances {
+		for _, job := range instance.Jobs {
+			name := instance.Name + "/" + job.Name
+
+			if len(cli.Flags.Jobs) > 0 {
+				selected := false
+				for _, sel := range cli.Flags.Jobs {
+					if sel == name || sel == instance.Name || sel == job.Name {
+						selected = true
+						matched[sel] = true
+					}
+				}
+
+				if !selected {
+					continue
+				}
+			}
+
+			flags, err := instance.apply(job, explicit)
+			if err != nil {
+				return nil, fmt.Errorf("job %q: %w", name, err)
+			}
+
+			if err = flags.validate(export); err != nil {
+				return nil, fmt.Errorf("job %q: %w", name, err)
+			}
+
+			jobs = append(jobs, &exportJob{name: name, flags: flags})
+		}
+	}
+
+	for _, sel := range cli.Flags.Jobs {
+		if !matched[sel] {
+			return nil, fmt.Errorf("job %q not found in config %q", sel, cli.Flags.Config)
+		}
+	}
+
+	return jobs, nil
+}
+
+// explicitFlags returns the names of all flags which were explicitly set, either
+// on the command line, or through their environment variables.
+func explicitFlags() map[string]bool {
+	explicit := make(map[string]bool)
+
+	for _, p := range cli.Context.Path {
+		if p.Flag != nil && !p.Resolved {
+			explicit[p.Flag.Name] = true
+		}
+	}
+
+	for _, flag := range cli.Context.Flags() {
+		for _, env := range flag.Envs {
+			if _, ok := os.LookupEnv(env); ok {
+				explicit[flag.Name] = true
+			}
+		}
+	}
+
+	return explicit
+}
+
+// override sets dst to src, if src is set and the flag wasn't explicitly set.
+func override[T any](explicit map[string]bool, name string, dst, src *T) {
+	if src != nil && !explicit[name] {
+		*dst = *src
+	}
+}
+
+// overrideSlice sets dst to src, if src isn't empty and the flag wasn't
+// explicitly set.
+func overrideSlice[T any](explicit map[string]bool, name string, dst *[]T, src []T) {
+	if len(src) > 0 && !explicit[name] {
+		*dst = slices.Clone(src)
+	}
+}
+
+// apply returns a copy of the flags, with the instance and job configuration
+// applied to all flags which weren't explicitly set.
+func (c *InstanceConfig) apply(job *JobConfig, explicit map[string]bool) (*Flags, error) {
+	flags := *cli.Flags
+	flags.Collections = slices.Clone(flags.Collections)
+	flags.Filters = slices.Clone(flags.Filters)
+	flags.Include = slices.Clone(flags.Include)
+	flags.Exclude = slices.Clone(flags.Exclude)
+	flags.IncludeCollections = slices.Clone(flags.IncludeCollections)
+	flags.ExcludeCollections = slices.Clone(flags.ExcludeCollections)
+
+	if c.URL != "" {
+		override(explicit, "url", &flags.URL, &c.URL)
+	}
+
+	// Token sources are mutually exclusive, so any token source provided through
+	// flags or environment variables replaces the configured one.
+	if !explicit["token"] && !explicit["token-file"] && !explicit["token-command"] {
+		if err := c.applyToken(&flags); err != nil {
+			return nil, err
+		}
+	}
+
+	override(explicit, "http-timeout", &flags.HTTPTimeout, c.HTTPTimeout)
+	override(explicit, "rewrite-redirect", &flags.RewriteRedirect, c.RewriteRedirect)
+	override(explicit, "retry-max-attempts", &flags.RetryMaxAttempts, c.RetryMaxAttempts)
+	override(explicit, "retry-base-delay", &flags.RetryBaseDelay, c.RetryBaseDelay)
+	override(explicit, "retry-max-delay", &flags.RetryMaxDelay, c.RetryMaxDelay)
+	override(explicit, "retry-max-after", &flags.RetryMaxAfter, c.RetryMaxAfter)
+	override(explicit, "ca-file", &flags.CAFile, c.CAFile)
+	override(explicit, "client-cert", &flags.ClientCert, c.ClientCert)
+	override(explicit, "client-key", &flags.ClientKey, c.ClientKey)
+	override(explicit, "tls-min-version", &flags.TLSMinVersion, c.TLSMinVersion)
+	override(explicit, "proxy-url", &flags.ProxyURL, c.ProxyURL)
+	override(explicit, "insecure-skip-verify", &flags.InsecureSkipVerify, c.InsecureSkipVerify)
+
+	override(explicit, "mode", &flags.Mode, job.Mode)
+	override(explicit, "concurrency", &flags.Concurrency, job.Concurrency)
+	overrideSlice(explicit, "format", &flags.Format, job.Format)
+	override(explicit, "exclude-attachments", &flags.ExcludeAttachments, job.ExcludeAttachments)
+	override(explicit, "exclude-private", &flags.ExcludePrivate, job.ExcludePrivate)
+	override(explicit, "extract", &flags.Extract, job.Extract)
+	override(explicit, "mirror", &flags.Mirror, job.Mirror)
+	override(explicit, "export-path", &flags.ExportPath, job.ExportPath)
+	overrideSlice(explicit, "collection", &flags.Collections, job.Collections)
+	overrideSlice(explicit, "filters", &flags.Filters, job.Filters)
+	overrideSlice(explicit, "include", &flags.Include, job.Include)
+	overrideSlice(explicit, "exclude", &flags.Exclude, job.Exclude)
+	overrideSlice(explicit, "include-collection", &flags.IncludeCollections, job.IncludeCollections)
+	overrideSlice(explicit, "exclude-collection", &flags.ExcludeCollections, job.ExcludeCollections)
+	override(explicit, "sanitize", &flags.Sanitize, job.Sanitize)
+
+	override(explicit, "max-extract-size", &flags.MaxExtractSize, job.MaxExtractSize)
+	override(explicit, "max-extract-files", &flags.MaxExtractFiles, job.MaxExtractFiles)
+	override(explicit, "max-compression-ratio", &flags.MaxCompressionRatio, job.MaxCompressionRatio)
+
+	override(explicit, "reuse", &flags.Reuse, job.Reuse)
+	override(explicit, "reuse-max-age", &flags.ReuseMaxAge, job.ReuseMaxAge)
+	override(explicit, "reuse-state-file", &flags.ReuseStateFile, job.ReuseStateFile)
+
+	override(explicit, "file-mode", &flags.FileMode, job.FileMode)
+	override(explicit, "dir-mode", &flags.DirMode, job.DirMode)
+	override(explicit, "uid", &flags.UID, job.UID)
+	override(explicit, "gid", &flags.GID, job.GID)
+
+	override(explicit, "snapshot", &flags.Snapshot, job.Snapshot)
+	override(explicit, "keep-last", &flags.KeepLast, job.KeepLast)
+	override(explicit, "keep-daily", &flags.KeepDaily, job.KeepDaily)
+	override(explicit, "keep-weekly", &flags.KeepWeekly, job.KeepWeekly)
+	override(explicit, "keep-monthly", &flags.KeepMonthly, job.KeepMonthly)
+
+	override(explicit, "git", &flags.Git, job.Git)
+	override(explicit, "git-branch", &flags.GitBranch, job.GitBranch)
+	override(explicit, "git-author-name", &flags.GitAuthorName, job.GitAuthorName)
+	override(explicit, "git-author-email", &flags.GitAuthorEmail, job.GitAuthorEmail)
+	override(explicit, "git-push-remote", &flags.GitPushRemote, job.GitPushRemote)
+
+	return &flags, nil
+}
+
+// applyToken sets the token source flags from the configured token source (if
+// any). Token files and commands are resolved on each run, rather than when the
+// config is loaded.
+func (c *InstanceConfig) applyToken(flags *Flags) error {
+	var sources int
+	for _, s := range []string{c.Token, c.TokenEnv, c.TokenFile, c.TokenCommand} {
+		if s != "" {
+			sources++
+		}
+	}
+
+	switch {
+	case sources > 1:
+		return errors.New("only one of token, token-env, token-file, or token-command can be provided")
+	case sources == 0:
+		return nil
+	}
+
+	flags.Token, flags.TokenFile, flags.TokenCommand = c.Token, c.TokenFile, c.TokenCommand
+
+	if c.TokenEnv != "" {
+		token, ok := os.LookupEnv(c.TokenEnv)
+		if !ok {
+			return fmt.Errorf("token environment variable %q is not set", c.TokenEnv)
+		}
+		flags.Token = strings.TrimSpace(token)
+	}
+	return nil
+}
+
+// validate checks the flags which are required, or restricted to specific values.
+// These aren't validated by the flag parser, as they can also be provided through
+// the config file. If export is false, only the flags needed to connect to Outline
+// are required.
+func (f *Flags) validate(export bool) error {
+	var sources int
+	for _, s := range []string{f.Token, f.TokenFile, f.TokenCommand} {
+		if s != "" {
+			sources++
+		}
+	}
+
+	var missing []string
+
+	if f.URL == "" {
+		missing = append(missing, "--url")
+	}
+	if sources == 0 {
+		missing = append(missing, "--token (or --token-file, --token-command)")
+	}
+	if export && len(f.Format) == 0 {
+		missing = append(missing, "--format")
+	}
+	if export && f.ExportPath == "" {
+		missing = append(missing, "--export-path")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required flags: %s", strings.Join(missing, ", "))
+	}
+
+	if sources > 1 {
+		return errors.New("only one of --token, --token-file, or --token-command can be provided")
+	}
+
+	if !slices.Contains([]string{modeFileOperation, modeDocuments}, f.Mode) {
+		return fmt.Errorf("--mode must be one of %q or %q, got %q", modeFileOperation, modeDocuments, f.Mode)
+	}
+
+	seen := make(map[string]bool, len(f.Format))
+	for _, format := range f.Format {
+		if _, ok := exportFormats[format]; !ok {
+			return fmt.Errorf("--format must be one of \"markdown\", \"html\" or \"json\", got %q", format)
+		}
+
+		if seen[format] {
+			return fmt.Errorf("--format %q provided multiple times", format)
+		}
+		seen[format] = true
+	}
+
+	if _, ok := tlsVersions[f.TLSMinVersion]; !ok {
+		return fmt.Errorf("--tls-min-version must be one of \"1.0\", \"1.1\", \"1.2\" or \"1.3\", got %q", f.TLSMinVersion)
+	}
+
+	if (f.ClientCert == "") != (f.ClientKey == "") {
+		return errors.New("--client-cert and --client-key must be provided together")
+	}
+
+	if !slices.Contains([]string{reuseNever, reuseSameOptions, reuseAny}, f.Reuse) {
+		return fmt.Errorf("--reuse must be one of %q, %q or %q, got %q", reuseNever, reuseSameOptions, reuseAny, f.Reuse)
+	}
+
+	if f.ReuseMaxAge <= 0 {
+		return fmt.Errorf("--reuse-max-age must be positive, got %s", f.ReuseMaxAge)
+	}
+
+	if !slices.Contains(sanitize.Strategies, f.Sanitize) {
+		return fmt.Errorf(
+			"--sanitize must be one of %q, %q, %q or %q, got %q",
+			sanitize.Strict, sanitize.Unicode, sanitize.WindowsSafe, sanitize.Slug, f.Sanitize,
+		)
+	}
+
+	if _, err := newExportFilter(f); err != nil {
+		return err
+	}
+
+	if export && f.Mirror && f.Git {
+		return errors.New("--mirror and --git cannot be used together (the git working tree is already replaced on each export)")
+	}
+
+	if export && f.Mirror && f.Mode == modeDocuments {
+		return fmt.Errorf("--mirror is not supported with --mode=%s (documents which no longer exist are already removed)", modeDocuments)
+	}
+
+	if export && f.Mode == modeDocuments && (len(f.Format) != 1 || f.Format[0] != "markdown") {
+		return fmt.Errorf("only the markdown format is supported with --mode=%s", modeDocuments)
+	}
+
+	return nil
+}
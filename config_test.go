@@ -0,0 +1,477 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+)
+
+// writeConfig writes a config file with the provided name and contents to a
+// temporary directory, returning its path.
+func writeConfig(t *testing.T, name, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+		want     map[string][]string // Formats of each job, by "instance/job".
+		wantErr  string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			contents: `
+instances:
+  - name: wiki
+    url: https://wiki.example.com
+    token: tok
+    http-timeout: 10s
+    jobs:
+      - name: nightly
+        format: markdown
+        export-path: /backups/wiki
+      - name: all
+        format: [json, html]
+        max-extract-size: 1GiB
+        file-mode: "0640"
+  - name: docs
+    url: https://docs.example.com
+    jobs:
+      - name: nightly
+`,
+			want: map[string][]string{
+				"wiki/nightly": {"markdown"},
+				"wiki/all":     {"json", "html"},
+				"docs/nightly": nil,
+			},
+		},
+		{
+			name: "toml",
+			file: "config.TOML",
+			contents: `
+[[instances]]
+name = "wiki"
+url = "https://wiki.example.com"
+token-file = "/run/secrets/wiki"
+
+[[instances.jobs]]
+name = "nightly"
+format = "markdown"
+
+[[instances.jobs]]
+name = "all"
+format = ["json", "html"]
+max-extract-size = "1GiB"
+file-mode = "0640"
+`,
+			want: map[string][]string{
+				"wiki/nightly": {"markdown"},
+				"wiki/all":     {"json", "html"},
+			},
+		},
+		{
+			name:     "yaml-unknown-field",
+			file:     "config.yml",
+			contents: "instances:\n  - name: wiki\n    jobs: [{name: nightly, formats: markdown}]\n",
+			wantErr:  "field formats not found",
+		},
+		{
+			name:     "toml-unknown-field",
+			file:     "config.toml",
+			contents: "[[instances]]\nname = \"wiki\"\n[[instances.jobs]]\nname = \"nightly\"\nformats = \"markdown\"\n",
+			wantErr:  `unknown field "instances.jobs.formats"`,
+		},
+		{
+			name:     "toml-invalid-format",
+			file:     "config.toml",
+			contents: "[[instances]]\nname = \"wiki\"\n[[instances.jobs]]\nname = \"nightly\"\nformat = 1\n",
+			wantErr:  "expected string or list of strings",
+		},
+		{
+			name:     "unsupported-extension",
+			file:     "config.json",
+			contents: "{}",
+			wantErr:  `unsupported config format ".json"`,
+		},
+		{
+			name:     "no-instances",
+			file:     "config.yaml",
+			contents: "instances: []\n",
+			wantErr:  "no instances defined",
+		},
+		{
+			name:     "instance-without-name",
+			file:     "config.yaml",
+			contents: "instances:\n  - url: https://wiki.example.com\n    jobs: [{name: nightly}]\n",
+			wantErr:  "instance 1: name is required",
+		},
+		{
+			name:     "no-jobs",
+			file:     "config.yaml",
+			contents: "instances:\n  - name: wiki\n",
+			wantErr:  `instance "wiki": no jobs defined`,
+		},
+		{
+			name:     "job-without-name",
+			file:     "config.yaml",
+			contents: "instances:\n  - name: wiki\n    jobs: [{name: nightly}, {format: json}]\n",
+			wantErr:  `instance "wiki": job 2: name is required`,
+		},
+		{
+			name:     "duplicate-job",
+			file:     "config.yaml",
+			contents: "instances:\n  - name: wiki\n    jobs: [{name: nightly}]\n  - name: wiki\n    jobs: [{name: nightly}]\n",
+			wantErr:  `duplicate job "wiki/nightly"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := writeConfig(t, tt.file, tt.contents)
+
+			config, err := loadConfig(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfig() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+
+			got := make(map[string][]string)
+			for _, instance := range config.Instances {
+				for _, job := range instance.Jobs {
+					got[instance.Name+"/"+job.Name] = job.Format
+				}
+			}
+
+			if !maps.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("loadConfig() jobs = %q, want %q", got, tt.want)
+			}
+
+			// Values are decoded with their flag types.
+			if job := config.Instances[0].Jobs[1]; *job.MaxExtractSize != 1<<30 || *job.FileMode != 0o640 {
+				t.Errorf("loadConfig() max-extract-size = %d, file-mode = %v, want 1GiB and 0640", *job.MaxExtractSize, *job.FileMode)
+			}
+		})
+	}
+}
+
+// resolvedJob is the subset of the flags of a resolved job checked by
+// [TestResolveJobs].
+type resolvedJob struct {
+	url         string
+	token       string
+	tokenFile   string
+	mode        string
+	format      string
+	exportPath  string
+	httpTimeout time.Duration
+}
+
+func TestResolveJobs(t *testing.T) {
+	config := `
+instances:
+  - name: wiki
+    url: https://wiki.example.com
+    token: wiki-token
+    jobs:
+      - name: nightly
+        format: markdown
+        export-path: /backups/wiki
+      - name: all
+        format: [json, html]
+        export-path: /backups/wiki-all
+  - name: docs
+    url: https://docs.example.com
+    token-file: /run/secrets/docs
+    http-timeout: 10s
+    jobs:
+      - name: nightly
+        mode: documents
+        format: markdown
+        export-path: /backups/docs
+`
+
+	wikiNightly := resolvedJob{
+		url:         "https://wiki.example.com",
+		token:       "wiki-token",
+		mode:        modeFileOperation,
+		format:      "markdown",
+		exportPath:  "/backups/wiki",
+		httpTimeout: api.DefaultHTTPTimeout,
+	}
+	wikiAll := wikiNightly
+	wikiAll.format = "json,html"
+	wikiAll.exportPath = "/backups/wiki-all"
+	docsNightly := resolvedJob{
+		url:         "https://docs.example.com",
+		tokenFile:   "/run/secrets/docs",
+		mode:        modeDocuments,
+		format:      "markdown",
+		exportPath:  "/backups/docs",
+		httpTimeout: 10 * time.Second,
+	}
+
+	tests := []struct {
+		name    string
+		config  string // Empty to not use --config.
+		args    []string
+		export  bool
+		want    map[string]resolvedJob // By job name.
+		wantErr string
+	}{
+		{
+			name:   "without-config",
+			args:   []string{"--url", "https://wiki.example.com", "--token", "wiki-token", "--format", "markdown", "--export-path", "/backups/wiki"},
+			export: true,
+			want:   map[string]resolvedJob{"": wikiNightly},
+		},
+		{
+			name:    "without-config-job",
+			args:    []string{"--job", "wiki/nightly"},
+			wantErr: "--job requires --config",
+		},
+		{
+			name:    "without-config-invalid",
+			args:    []string{"--url", "https://wiki.example.com", "--token", "wiki-token"},
+			export:  true,
+			wantErr: "missing required flags: --format, --export-path",
+		},
+		{
+			name:   "all",
+			config: config,
+			export: true,
+			want:   map[string]resolvedJob{"wiki/nightly": wikiNightly, "wiki/all": wikiAll, "docs/nightly": docsNightly},
+		},
+		{
+			name:   "select-job-name",
+			config: config,
+			args:   []string{"--job", "nightly"},
+			export: true,
+			want:   map[string]resolvedJob{"wiki/nightly": wikiNightly, "docs/nightly": docsNightly},
+		},
+		{
+			name:   "select-instance-and-full-name",
+			config: config,
+			args:   []string{"--job", "docs", "--job", "wiki/all"},
+			export: true,
+			want:   map[string]resolvedJob{"wiki/all": wikiAll, "docs/nightly": docsNightly},
+		},
+		{
+			name:    "select-not-found",
+			config:  config,
+			args:    []string{"--job", "wiki", "--job", "missing"},
+			wantErr: `job "missing" not found`,
+		},
+		{
+			name:   "explicit-flags",
+			config: config,
+			args:   []string{"--job", "docs", "--token", "flag-token", "--export-path", "/override", "--http-timeout", "1m"},
+			export: true,
+			want: map[string]resolvedJob{"docs/nightly": {
+				url:         "https://docs.example.com",
+				token:       "flag-token",
+				mode:        modeDocuments,
+				format:      "markdown",
+				exportPath:  "/override",
+				httpTimeout: time.Minute,
+			}},
+		},
+		{
+			name:    "invalid-job",
+			config:  "instances:\n  - name: wiki\n    url: https://wiki.example.com\n    token: tok\n    jobs: [{name: nightly, mode: bogus}]\n",
+			wantErr: `job "wiki/nightly": --mode must be one of`,
+		},
+		{
+			name:   "connect-only",
+			config: "instances:\n  - name: wiki\n    url: https://wiki.example.com\n    token: tok\n    jobs: [{name: nightly}]\n",
+			want: map[string]resolvedJob{"wiki/nightly": {
+				url:         "https://wiki.example.com",
+				token:       "tok",
+				mode:        modeFileOperation,
+				httpTimeout: api.DefaultHTTPTimeout,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.config != "" {
+				args = append([]string{"--config", writeConfig(t, "config.yaml", tt.config)}, args...)
+			}
+
+			flags := setFlags(t, args...)
+			base := *flags
+
+			jobs, err := resolveJobs(tt.export)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveJobs() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("resolveJobs() error = %v", err)
+			}
+
+			got := make(map[string]resolvedJob, len(jobs))
+			for _, job := range jobs {
+				got[job.name] = resolvedJob{
+					url:         job.flags.URL,
+					token:       job.flags.Token,
+					tokenFile:   job.flags.TokenFile,
+					mode:        job.flags.Mode,
+					format:      strings.Join(job.flags.Format, ","),
+					exportPath:  job.flags.ExportPath,
+					httpTimeout: job.flags.HTTPTimeout,
+				}
+			}
+
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("resolveJobs() = %+v, want %+v", got, tt.want)
+			}
+
+			// The global flags aren't modified by the config.
+			if flags.URL != base.URL || flags.ExportPath != base.ExportPath || !slices.Equal(flags.Format, base.Format) {
+				t.Errorf("resolveJobs() modified the global flags: %+v", flags)
+			}
+		})
+	}
+}
+
+func TestApplyToken(t *testing.T) {
+	t.Setenv("OUTLINE_EXPORT_TEST_TOKEN", " env-token\n")
+
+	tests := []struct {
+		name     string
+		instance *InstanceConfig
+		want     [3]string // Token, token file, and token command.
+		wantErr  string
+	}{
+		{name: "none", instance: &InstanceConfig{}, want: [3]string{"flag-token", "", ""}},
+		{name: "token", instance: &InstanceConfig{Token: "tok"}, want: [3]string{"tok", "", ""}},
+		{name: "token-env", instance: &InstanceConfig{TokenEnv: "OUTLINE_EXPORT_TEST_TOKEN"}, want: [3]string{"env-token", "", ""}},
+		{name: "token-file", instance: &InstanceConfig{TokenFile: "/run/secrets/token"}, want: [3]string{"", "/run/secrets/token", ""}},
+		{name: "token-command", instance: &InstanceConfig{TokenCommand: "pass outline"}, want: [3]string{"", "", "pass outline"}},
+		{
+			name:     "token-env-unset",
+			instance: &InstanceConfig{TokenEnv: "OUTLINE_EXPORT_TEST_UNSET"},
+			wantErr:  `token environment variable "OUTLINE_EXPORT_TEST_UNSET" is not set`,
+		},
+		{
+			name:     "multiple",
+			instance: &InstanceConfig{Token: "tok", TokenFile: "/run/secrets/token"},
+			wantErr:  "only one of token, token-env, token-file, or token-command",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := &Flags{Token: "flag-token"}
+
+			err := tt.instance.applyToken(flags)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("applyToken() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("applyToken() error = %v", err)
+			}
+
+			if got := [3]string{flags.Token, flags.TokenFile, flags.TokenCommand}; got != tt.want {
+				t.Errorf("applyToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	base := []string{"--url", "https://wiki.example.com", "--token", "tok", "--format", "markdown", "--export-path", "out"}
+
+	tests := []struct {
+		name    string
+		args    []string
+		export  bool
+		wantErr string
+	}{
+		{name: "valid", args: base, export: true},
+		{name: "connect-only", args: []string{"--url", "https://wiki.example.com", "--token-file", "token"}},
+		{
+			name:    "missing",
+			export:  true,
+			wantErr: "missing required flags: --url, --token (or --token-file, --token-command), --format, --export-path",
+		},
+		{name: "missing-connect-only", args: []string{"--url", "https://wiki.example.com"}, wantErr: "missing required flags: --token"},
+		{name: "multiple-tokens", args: append(slices.Clone(base), "--token-command", "pass outline"), wantErr: "only one of --token"},
+		{name: "invalid-format", args: append(slices.Clone(base), "--format", "pdf"), export: true, wantErr: `--format must be one of`},
+		{name: "duplicate-format", args: append(slices.Clone(base), "--format", "markdown"), export: true, wantErr: `--format "markdown" provided multiple times`},
+		{name: "multiple-formats", args: append(slices.Clone(base), "--format", "json"), export: true},
+		{name: "client-cert-without-key", args: append(slices.Clone(base), "--client-cert", "cert.pem"), wantErr: "must be provided together"},
+		{name: "reuse-max-age", args: append(slices.Clone(base), "--reuse-max-age", "0s"), wantErr: "--reuse-max-age must be positive"},
+		{name: "invalid-include", args: append(slices.Clone(base), "--include", "["), wantErr: `invalid include rule "["`},
+		{name: "mirror-git", args: append(slices.Clone(base), "--mirror", "--git"), export: true, wantErr: "cannot be used together"},
+		{name: "mirror-git-connect-only", args: append(slices.Clone(base), "--mirror", "--git")},
+		{name: "mirror-documents", args: append(slices.Clone(base), "--mirror", "--mode", "documents"), export: true, wantErr: "--mirror is not supported"},
+		{name: "documents", args: append(slices.Clone(base), "--mode", "documents"), export: true},
+		{
+			name:    "documents-json",
+			args:    append(slices.Clone(base), "--mode", "documents", "--format", "json"),
+			export:  true,
+			wantErr: "only the markdown format is supported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			flags, _ := parseFlags(t, tt.args...)
+
+			err := flags.validate(tt.export)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validate(%t) error = %v", tt.export, err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate(%t) error = %v, want it to contain %q", tt.export, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/scheduler"
+)
+
+type DaemonCommand struct {
+	Schedule   string        `name:"schedule" env:"SCHEDULE" required:"" help:"When to run exports. Either a cron expression (e.g. '0 3 * * *'), a descriptor (e.g. '@daily', '@every 6h'), or an interval (e.g. '6h')"`
+	Jitter     time.Duration `name:"jitter" env:"SCHEDULE_JITTER" help:"Maximum random delay added to each scheduled run, to avoid many instances exporting at the same time"`
+	RunOnStart bool          `name:"run-on-start" env:"RUN_ON_START" help:"Run an export immediately on startup, rather than waiting for the first scheduled run"`
+	History    int           `name:"history" env:"HISTORY" default:"${HISTORY}" help:"Number of run results to keep in memory for status reporting"`
+
+	Listen      string        `name:"listen" env:"LISTEN" help:"Address to serve /healthz, /readyz, /status and /metrics endpoints on (e.g. ':8080'). Disabled if empty"`
+	ReadyMaxAge time.Duration `name:"ready-max-age" env:"READY_MAX_AGE" help:"/readyz fails if the last successful export is older than this. Defaults to twice the schedule interval (plus jitter)"`
+}
+
+// runDaemon runs exports based on the configured schedule, until the context is
+// canceled (e.g. SIGTERM/SIGINT). An in-progress run is canceled on shutdown, and
+// any partial output is removed.
+func runDaemon(ctx context.Context, logger *slog.Logger, notifier *runNotifier, jobs []*exportJob) error {
+	// Copy the daemon flags before any jobs run, as the global flags are swapped
+	// for the flags of each job while it's running, which would race with the
+	// status server.
+	flags := cli.Flags.Daemon
+
+	schedule, err := scheduler.Parse(flags.Schedule)
+	if err != nil {
+		return err
+	}
+
+	sched := scheduler.New(&scheduler.Options{
+		Schedule:   schedule,
+		Jitter:     flags.Jitter,
+		History:    flags.History,
+		RunOnStart: flags.RunOnStart,
+		Logger:     logger,
+	}, func(ctx context.Context) ([]*runResult, error) {
+		return runJobs(ctx, logger, notifier, jobs)
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 1)
+
+	if flags.Listen != "" {
+		readyMaxAge := flags.ReadyMaxAge
+		if readyMaxAge <= 0 {
+			readyMaxAge = 2*sched.Interval() + flags.Jitter
+		}
+
+		srv := newStatusServer(logger, sched, readyMaxAge)
+
+		wg.Go(func() {
+			if err := srv.serve(ctx, flags.Listen); err != nil {
+				errs <- err
+				cancel()
+			}
+		})
+	}
+
+	logger.InfoContext(ctx, "daemon started", "schedule", flags.Schedule)
+	sched.Start(ctx)
+	cancel()
+	wg.Wait()
+	logger.InfoContext(ctx, "daemon stopped")
+
+	select {
+	case err = <-errs:
+		return err
+	default:
+		return nil
+	}
+}
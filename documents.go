@@ -0,0 +1,654 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+	"github.com/lrstanley/outline-export/internal/gitrepo"
+	"github.com/lrstanley/outline-export/internal/sanitize"
+)
+
+const (
+	modeFileOperation = "file-operation"
+	modeDocuments     = "documents"
+
+	// documentStateFile is the name of the file (within the export path, or the
+	// git directory when using --git) which tracks which documents have been
+	// written, so interrupted exports can be resumed, and subsequent exports only
+	// fetch documents which have changed.
+	documentStateFile = ".outline-export-state.json"
+
+	// documentStateSaveInterval is the number of written documents after which
+	// the state file is persisted.
+	documentStateSaveInterval = 25
+)
+
+// documentState tracks the documents which have been written to the export path.
+type documentState struct {
+	mu   sync.Mutex
+	path string
+
+	Documents map[string]*documentStateEntry `json:"documents"`
+}
+
+type documentStateEntry struct {
+	ID           string    `json:"id"`
+	CollectionID string    `json:"collectionId"`
+	Path         string    `json:"path"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	Hash         string    `json:"hash"` // SHA-256 of the written content.
+	Size         int64     `json:"size"`
+}
+
+// loadDocumentState loads the document state from the provided path. If no state
+// exists yet, an empty state is returned.
+func loadDocumentState(path string) (*documentState, error) {
+	state := &documentState{
+		path:      path,
+		Documents: make(map[string]*documentStateEntry),
+	}
+
+	b, err := os.ReadFile(state.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file %q: %w", state.path, err)
+	}
+
+	if err = json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("failed to decode state file %q: %w", state.path, err)
+	}
+
+	if state.Documents == nil {
+		state.Documents = make(map[string]*documentStateEntry)
+	}
+	return state, nil
+}
+
+// isCurrent returns true if the document was already written with the same
+// updated timestamp, and the file still exists.
+func (s *documentState) isCurrent(root string, doc *api.Document, path string) bool {
+	s.mu.Lock()
+	entry, ok := s.Documents[doc.ID]
+	s.mu.Unlock()
+
+	if !ok || entry.Path != path || !entry.UpdatedAt.Equal(doc.UpdatedAt) {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(root, path))
+	return err == nil
+}
+
+func (s *documentState) get(id string) *documentStateEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Documents[id]
+}
+
+func (s *documentState) set(entry *documentStateEntry) {
+	s.mu.Lock()
+	s.Documents[entry.ID] = entry
+	s.mu.Unlock()
+}
+
+func (s *documentState) delete(id string) {
+	s.mu.Lock()
+	delete(s.Documents, id)
+	s.mu.Unlock()
+}
+
+// save atomically writes the state to disk.
+func (s *documentState) save() error {
+	s.mu.Lock()
+	b, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	return writeFileAtomic(s.path, b, 0o600)
+}
+
+// documentJob is a single document which should be exported.
+type documentJob struct {
+	doc      *api.Document
+	path     string              // Relative to the export path.
+	source   string              // Unsanitized path (collection name and document titles).
+	previous *documentStateEntry // Nil if the document wasn't previously exported.
+}
+
+// documentSummary contains the changes made by a document export.
+type documentSummary struct {
+	mu sync.Mutex
+
+	Added     int
+	Changed   int
+	Unchanged int
+	Removed   int
+}
+
+func (s *documentSummary) add(fn func(s *documentSummary)) {
+	s.mu.Lock()
+	fn(s)
+	s.mu.Unlock()
+}
+
+// runDocumentExport exports all documents of the selected collections individually,
+// using documents.export, and writes them into the export path, using the document
+// structure of each collection. Only documents which are new or were updated since
+// the last export are fetched, which also allows resuming interrupted exports.
+// Files of documents which were removed or moved are deleted. If repo is
+// provided, the state is kept outside of the working tree, any other files which
+// aren't part of the export are removed, and (like in file operation mode) the
+// working tree is only replaced once the export succeeds.
+func runDocumentExport(
+	ctx context.Context,
+	client *api.Client,
+	filter *exportFilter,
+	repo *gitrepo.Repo,
+	result *runResult,
+) error {
+	root := cli.Flags.ExportPath
+
+	err := os.MkdirAll(root, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create export directory %q: %w", root, err)
+	}
+
+	state, err := openDocumentState(root, repo)
+	if err != nil {
+		return err
+	}
+
+	if repo != nil {
+		// Write into a copy of the working tree, which only replaces it once the
+		// export succeeds, so a failed export leaves it untouched.
+		staging, serr := repo.StagingCopy()
+		if serr != nil {
+			return serr
+		}
+		root = staging
+
+		defer func() {
+			// Only left behind if the export failed.
+			if rerr := os.RemoveAll(staging); rerr != nil {
+				slog.WarnContext(ctx, "failed to remove staging directory", "error", rerr)
+			}
+		}()
+	}
+
+	collections, err := documentCollections(ctx, client, filter)
+	if err != nil {
+		return err
+	}
+
+	// Resolve collection names in a stable order, so collisions are always
+	// resolved the same way.
+	resolver := newNameResolver(ctx)
+	for _, collection := range slices.SortedFunc(slices.Values(collections), compareCollectionIDs) {
+		resolver.Resolve("", collection.ID, collection.Name, false)
+	}
+
+	var jobs []*documentJob
+
+	for _, collection := range collections {
+		result.Collections = append(result.Collections, collection.Name)
+
+		cjobs, err := collectionDocumentJobs(ctx, client, resolver, collection)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, cjobs...)
+	}
+
+	jobs = slices.DeleteFunc(jobs, func(job *documentJob) bool {
+		if filter.entry(job.source, false, false) {
+			return false
+		}
+		slog.DebugContext(ctx, "skipping document (excluded by filters)", "id", job.doc.ID, "path", job.source)
+		result.addSkipped("filter")
+		return true
+	})
+
+	summary := &documentSummary{}
+	current := make(map[string]bool, len(jobs))
+	paths := make(map[string]bool, len(jobs))
+
+	var pending []*documentJob
+	for _, job := range jobs {
+		current[job.doc.ID] = true
+		paths[job.path] = true
+
+		if state.isCurrent(root, job.doc, job.path) {
+			slog.DebugContext(ctx, "skipping document (unchanged)", "id", job.doc.ID, "path", job.path)
+			summary.Unchanged++
+			continue
+		}
+
+		job.previous = state.get(job.doc.ID)
+		pending = append(pending, job)
+	}
+
+	slog.InfoContext(
+		ctx, "exporting documents",
+		"collections", len(collections),
+		"documents", len(jobs),
+		"pending", len(pending),
+		"concurrency", cli.Flags.Concurrency,
+	)
+
+	// The state must match the working tree, so when staging, it's only persisted
+	// once the working tree has been replaced.
+	checkpoint := repo == nil
+
+	err = exportDocuments(ctx, client, root, state, summary, result, pending, checkpoint)
+
+	if err == nil {
+		// Remove files of documents which no longer exist (or are no longer part of
+		// the export), and files left behind by documents which were moved.
+		for id, entry := range state.Documents {
+			if current[id] {
+				continue
+			}
+
+			if !paths[entry.Path] {
+				removeDocumentFile(ctx, root, entry.Path)
+			}
+			state.delete(id)
+			summary.Removed++
+		}
+
+		for _, job := range pending {
+			if job.previous == nil || job.previous.Path == job.path || paths[job.previous.Path] {
+				continue
+			}
+			removeDocumentFile(ctx, root, job.previous.Path)
+		}
+
+		err = applyDocumentMetadata(root, jobs)
+	}
+
+	if err == nil && repo != nil {
+		var removed []string
+		removed, err = gitrepo.Prune(root, func(path string) bool { return paths[path] })
+		for _, path := range removed {
+			slog.InfoContext(ctx, "removed file (not part of the export)", "path", path)
+		}
+
+		if err == nil {
+			err = repo.Replace(root)
+			if err != nil {
+				err = fmt.Errorf("failed to replace git working tree: %w", err)
+			}
+		}
+
+		// Written documents are only in the working tree if it was replaced.
+		checkpoint = err == nil
+	}
+
+	result.addChanged(summary.Added + summary.Changed + summary.Removed)
+
+	// Otherwise, always persist the state, so interrupted exports can be resumed.
+	if checkpoint {
+		if serr := state.save(); serr != nil {
+			err = errors.Join(err, serr)
+		}
+	}
+
+	slog.InfoContext(
+		ctx, "document export summary",
+		"added", summary.Added,
+		"changed", summary.Changed,
+		"unchanged", summary.Unchanged,
+		"removed", summary.Removed,
+	)
+	return err
+}
+
+// openDocumentState loads the document state of the export path. When using
+// git, the state is kept in the git directory, so it's never committed. State
+// files within the working tree (written by previous versions) are still loaded
+// if no state exists there yet, and are removed from the working tree along with
+// any other files which aren't part of the export.
+func openDocumentState(root string, repo *gitrepo.Repo) (*documentState, error) {
+	path := filepath.Join(root, documentStateFile)
+	if repo == nil {
+		return loadDocumentState(path)
+	}
+
+	dir, err := repo.GitDir()
+	if err != nil {
+		return nil, err
+	}
+	dst := filepath.Join(dir, documentStateFile)
+
+	if _, err = os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+		return loadDocumentState(dst)
+	}
+
+	state, err := loadDocumentState(path)
+	if err != nil {
+		return nil, err
+	}
+	state.path = dst
+	return state, nil
+}
+
+// removeDocumentFile removes a previously exported document, and any parent
+// directories (within the export path) which are left empty.
+func removeDocumentFile(ctx context.Context, root, path string) {
+	err := os.Remove(filepath.Join(root, path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.WarnContext(ctx, "failed to remove document", "path", path, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "removed document", "path", path)
+
+	for dir := filepath.Dir(path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		// Fails if the directory isn't empty, which is what we want.
+		if os.Remove(filepath.Join(root, dir)) != nil {
+			return
+		}
+	}
+}
+
+// documentCollections returns the collections which should be exported, based
+// on the provided flags.
+func documentCollections(ctx context.Context, client *api.Client, filter *exportFilter) ([]*api.Collection, error) {
+	var collections []*api.Collection
+
+	if len(cli.Flags.Collections) > 0 {
+		var err error
+		collections, err = resolveCollections(ctx, client, cli.Flags.Collections)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for collection, err := range client.ListCollections(ctx) {
+			if err != nil {
+				return nil, fmt.Errorf("failed to list collections: %w", err)
+			}
+
+			if collection.IsPrivate() && cli.Flags.ExcludePrivate {
+				slog.DebugContext(ctx, "skipping private collection", "id", collection.ID, "name", collection.Name)
+				continue
+			}
+			collections = append(collections, collection)
+		}
+	}
+
+	return slices.DeleteFunc(collections, func(collection *api.Collection) bool {
+		if filter.collection(collection.Name) {
+			return false
+		}
+		slog.DebugContext(ctx, "skipping collection (excluded by filters)", "id", collection.ID, "name", collection.Name)
+		return true
+	}), nil
+}
+
+// collectionDocumentJobs lists all documents within a collection, and resolves
+// the path they should be written to, based on the document structure of the
+// collection. Documents with children are written alongside a folder of the same
+// name, which contains the children. Documents which would be written to the
+// same path get a stable suffix, based on their ID.
+func collectionDocumentJobs(
+	ctx context.Context,
+	client *api.Client,
+	resolver *sanitize.Resolver,
+	collection *api.Collection,
+) ([]*documentJob, error) {
+	structure, err := client.GetCollectionStructure(ctx, collection.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch structure of collection %q: %w", collection.Name, err)
+	}
+
+	base := resolver.Resolve("", collection.ID, collection.Name, false)
+	if base == "" {
+		base = collection.ID
+	}
+
+	paths := make(map[string]string)
+	sources := make(map[string]string)
+
+	var walk func(dir, source string, nodes []*api.NavigationNode)
+	walk = func(dir, source string, nodes []*api.NavigationNode) {
+		// Resolve names in a stable order (rather than the order of documents in
+		// the sidebar, which can change), so collisions are always resolved the
+		// same way.
+		for _, node := range slices.SortedFunc(slices.Values(nodes), func(a, b *api.NavigationNode) int {
+			return strings.Compare(a.ID, b.ID)
+		}) {
+			resolver.Resolve(dir, node.ID, node.Title, false)
+		}
+
+		for _, node := range nodes {
+			name := resolver.Resolve(dir, node.ID, node.Title, false)
+			if name == "" {
+				name = node.ID
+			}
+
+			paths[node.ID] = filepath.Join(dir, name+".md")
+			sources[node.ID] = source + "/" + node.Title + ".md"
+			walk(filepath.Join(dir, name), source+"/"+node.Title, node.Children)
+		}
+	}
+	walk(base, collection.Name, structure)
+
+	var jobs []*documentJob
+
+	for doc, err := range client.ListDocuments(ctx, collection.ID) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to list documents of collection %q: %w", collection.Name, err)
+		}
+
+		path, ok := paths[doc.ID]
+		if !ok {
+			// Not part of the structure (shouldn't generally happen), so place it
+			// at the root of the collection.
+			name := resolver.Resolve(base, doc.ID, doc.Title, false)
+			if name == "" {
+				name = doc.ID
+			}
+			path = filepath.Join(base, name+".md")
+			sources[doc.ID] = collection.Name + "/" + doc.Title + ".md"
+		}
+
+		jobs = append(jobs, &documentJob{doc: doc, path: path, source: sources[doc.ID]})
+	}
+
+	return jobs, nil
+}
+
+// compareCollectionIDs compares collections by ID, for sorting.
+func compareCollectionIDs(a, b *api.Collection) int {
+	return strings.Compare(a.ID, b.ID)
+}
+
+// exportDocuments fetches and writes the provided documents, with bounded
+// concurrency. The state is updated as documents are written, and periodically
+// persisted if checkpoint is true.
+func exportDocuments(
+	ctx context.Context,
+	client *api.Client,
+	root string,
+	state *documentState,
+	summary *documentSummary,
+	result *runResult,
+	jobs []*documentJob,
+	checkpoint bool,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan *documentJob)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		errs      []error
+		completed int
+	)
+
+	for range max(cli.Flags.Concurrency, 1) {
+		wg.Go(func() {
+			for job := range queue {
+				entry, written, err := exportDocument(ctx, client, root, job)
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					cancel()
+					continue
+				}
+
+				state.set(entry)
+				summary.add(func(s *documentSummary) {
+					switch {
+					case job.previous == nil:
+						s.Added++
+					case job.previous.Hash != entry.Hash || job.previous.Path != entry.Path:
+						s.Changed++
+					default:
+						s.Unchanged++
+					}
+				})
+
+				mu.Lock()
+				completed++
+				result.addBytes(entry.Size)
+				if written {
+					result.addExtracted()
+				}
+				save := checkpoint && completed%documentStateSaveInterval == 0
+				mu.Unlock()
+
+				if save {
+					if err = state.save(); err != nil {
+						slog.WarnContext(ctx, "failed to save state", "error", err)
+					}
+				}
+			}
+		})
+	}
+
+feed:
+	for _, job := range jobs {
+		select {
+		case <-ctx.Done():
+			break feed
+		case queue <- job:
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(errs) == 0 && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Join(errs...)
+}
+
+// applyDocumentMetadata applies the updated time of each document to its file,
+// and the latest updated time of the documents within each directory to the
+// directory, along with the mode and owner flags.
+func applyDocumentMetadata(root string, jobs []*documentJob) error {
+	times := make(dirTimes)
+
+	for _, job := range jobs {
+		if err := applyMetadata(osFS{}, filepath.Join(root, job.path), false, job.doc.UpdatedAt); err != nil {
+			return err
+		}
+		times.add(job.path, false, job.doc.UpdatedAt)
+	}
+
+	return times.apply(osFS{}, root)
+}
+
+// exportDocument fetches a single document as Markdown, and writes it to the
+// export path. If the content is identical to the previously exported content,
+// the file is left as-is, and written is false.
+func exportDocument(ctx context.Context, client *api.Client, root string, job *documentJob) (entry *documentStateEntry, written bool, err error) {
+	text, err := client.ExportDocument(ctx, job.doc.ID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to export document %q: %w", job.doc.ID, err)
+	}
+
+	sum := sha256.Sum256([]byte(text))
+
+	entry = &documentStateEntry{
+		ID:           job.doc.ID,
+		CollectionID: job.doc.CollectionID,
+		Path:         job.path,
+		UpdatedAt:    job.doc.UpdatedAt,
+		Hash:         hex.EncodeToString(sum[:]),
+		Size:         int64(len(text)),
+	}
+
+	dst := filepath.Join(root, job.path)
+
+	if job.previous != nil && job.previous.Hash == entry.Hash && job.previous.Path == entry.Path {
+		if _, err = os.Stat(dst); err == nil {
+			slog.DebugContext(ctx, "document content unchanged", "id", job.doc.ID, "path", job.path)
+			return entry, false, nil
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return nil, false, fmt.Errorf("failed to create parent dirs for %q: %w", job.path, err)
+	}
+
+	if err = writeFileAtomic(dst, []byte(text), 0o600); err != nil {
+		return nil, false, err
+	}
+
+	slog.InfoContext(ctx, "document written", "id", job.doc.ID, "path", job.path)
+	return entry, true, nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory,
+// and then renames it to the destination, so readers never see a partially
+// written file.
+func writeFileAtomic(dst string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %q: %w", dst, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %q: %w", dst, err)
+	}
+
+	if err = tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to set permissions on %q: %w", dst, err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %q: %w", dst, err)
+	}
+
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to rename %q: %w", dst, err)
+	}
+	return nil
+}
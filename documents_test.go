@@ -0,0 +1,390 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+	"github.com/lrstanley/outline-export/internal/gitrepo"
+	"github.com/lrstanley/outline-export/internal/sanitize"
+)
+
+func TestCollectionDocumentJobs(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, map[string]func(map[string]any) any{
+		"/collections.documents": func(map[string]any) any {
+			return map[string]any{"data": []map[string]any{
+				{"id": "d1", "title": "Welcome", "children": []map[string]any{
+					{"id": "d2", "title": "Child: Notes"},
+				}},
+				{"id": "d3", "title": "Welcome"},
+			}}
+		},
+		"/documents.list": func(map[string]any) any {
+			return map[string]any{"data": []map[string]any{
+				{"id": "d1", "title": "Welcome"},
+				{"id": "d2", "title": "Child: Notes"},
+				{"id": "d3", "title": "Welcome"},
+				{"id": "d4", "title": "Not in structure"},
+			}}
+		},
+	})
+
+	collection := &api.Collection{ID: "c1", Name: "Engineering"}
+
+	jobs, err := collectionDocumentJobs(t.Context(), client, sanitize.NewResolver(sanitize.Strict), collection)
+	if err != nil {
+		t.Fatalf("collectionDocumentJobs() error = %v", err)
+	}
+
+	type job struct{ id, path, source string }
+
+	got := make([]job, 0, len(jobs))
+	for _, j := range jobs {
+		got = append(got, job{id: j.doc.ID, path: filepath.ToSlash(j.path), source: j.source})
+	}
+
+	// Documents with children are written alongside a folder with the same name,
+	// and the second "Welcome" document gets a stable suffix.
+	want := []job{
+		{id: "d1", path: "Engineering/Welcome.md", source: "Engineering/Welcome.md"},
+		{id: "d2", path: "Engineering/Welcome/Child- Notes.md", source: "Engineering/Welcome/Child: Notes.md"},
+		{id: "d3", path: "Engineering/Welcome~f451a6.md", source: "Engineering/Welcome.md"},
+		{id: "d4", path: "Engineering/Not in structure.md", source: "Engineering/Not in structure.md"},
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("collectionDocumentJobs() = %+v, want %+v", got, want)
+	}
+}
+
+func TestExportDocument(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, map[string]func(map[string]any) any{
+		"/documents.export": func(body map[string]any) any {
+			return map[string]any{"data": "# " + body["id"].(string)}
+		},
+	})
+
+	root := t.TempDir()
+	updated := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	job := &documentJob{
+		doc:  &api.Document{ID: "d1", CollectionID: "c1", UpdatedAt: updated},
+		path: filepath.Join("Engineering", "Welcome.md"),
+	}
+
+	entry, written, err := exportDocument(t.Context(), client, root, job)
+	if err != nil {
+		t.Fatalf("exportDocument() error = %v", err)
+	}
+
+	if !written || entry.Path != job.path || !entry.UpdatedAt.Equal(updated) || entry.Size != int64(len("# d1")) {
+		t.Errorf("exportDocument() = (%+v, %v), want the document to be written", entry, written)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(root, job.path)); err != nil || string(b) != "# d1" {
+		t.Errorf("written document = %q (error = %v), want %q", b, err, "# d1")
+	}
+
+	// Same content as the previous export, so the file is left as-is.
+	job.previous = entry
+
+	if _, written, err = exportDocument(t.Context(), client, root, job); err != nil || written {
+		t.Errorf("exportDocument() = (written: %v, error: %v), want the unchanged document to be skipped", written, err)
+	}
+
+	// Unless the file no longer exists.
+	if err = os.Remove(filepath.Join(root, job.path)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, written, err = exportDocument(t.Context(), client, root, job); err != nil || !written {
+		t.Errorf("exportDocument() = (written: %v, error: %v), want the missing document to be written", written, err)
+	}
+}
+
+func TestRemoveDocumentFile(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, name := range []string{"a/b/c.md", "a/d.md"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeDocumentFile(t.Context(), root, filepath.FromSlash("a/b/c.md"))
+
+	// The emptied parent is removed, but not parents which still have files.
+	if _, err := os.Stat(filepath.Join(root, "a", "b")); !os.IsNotExist(err) {
+		t.Errorf("empty parent directory still exists (error = %v)", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "a", "d.md")); err != nil {
+		t.Errorf("sibling document was removed: %v", err)
+	}
+
+	removeDocumentFile(t.Context(), root, filepath.FromSlash("a/d.md"))
+
+	if entries, err := os.ReadDir(root); err != nil || len(entries) != 0 {
+		t.Errorf("export path = %v (error = %v), want it to be empty", entries, err)
+	}
+}
+
+func TestDocumentStateIsCurrent(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	updated := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+
+	if err := os.WriteFile(filepath.Join(root, "a.md"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	state := &documentState{Documents: map[string]*documentStateEntry{
+		"d1": {ID: "d1", Path: "a.md", UpdatedAt: updated},
+		"d2": {ID: "d2", Path: "missing.md", UpdatedAt: updated},
+	}}
+
+	tests := []struct {
+		name    string
+		id      string
+		path    string
+		updated time.Time
+		want    bool
+	}{
+		{name: "current", id: "d1", path: "a.md", updated: updated, want: true},
+		{name: "updated", id: "d1", path: "a.md", updated: updated.Add(time.Second), want: false},
+		{name: "moved", id: "d1", path: "b.md", updated: updated, want: false},
+		{name: "file-missing", id: "d2", path: "missing.md", updated: updated, want: false},
+		{name: "new", id: "d3", path: "a.md", updated: updated, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc := &api.Document{ID: tt.id, UpdatedAt: tt.updated}
+			if got := state.isCurrent(root, doc, tt.path); got != tt.want {
+				t.Errorf("isCurrent(%q, %q) = %v, want %v", tt.id, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentStateSave(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), documentStateFile)
+
+	state, err := loadDocumentState(path)
+	if err != nil || len(state.Documents) != 0 {
+		t.Fatalf("loadDocumentState() = (%+v, %v), want an empty state", state, err)
+	}
+
+	entry := &documentStateEntry{
+		ID:           "d1",
+		CollectionID: "c1",
+		Path:         "a.md",
+		UpdatedAt:    time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC),
+		Hash:         "abc",
+		Size:         3,
+	}
+	state.set(entry)
+
+	if err = state.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	loaded, err := loadDocumentState(path)
+	if err != nil {
+		t.Fatalf("loadDocumentState() error = %v", err)
+	}
+
+	if got := loaded.get("d1"); got == nil || *got != *entry {
+		t.Errorf("loadDocumentState() d1 = %+v, want %+v", got, entry)
+	}
+
+	if err = os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = loadDocumentState(path); err == nil {
+		t.Error("loadDocumentState() error = nil, want an error for a corrupt state file")
+	}
+}
+
+func TestOpenDocumentStateGit(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+
+	repo, err := gitrepo.Open(&gitrepo.Options{Path: root})
+	if err != nil {
+		t.Fatalf("failed to open git repository: %v", err)
+	}
+
+	// State files written to the working tree by previous versions are loaded,
+	// but saved to the git directory.
+	legacy := `{"documents":{"d1":{"id":"d1","path":"a.md"}}}`
+	if err = os.WriteFile(filepath.Join(root, documentStateFile), []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := openDocumentState(root, repo)
+	if err != nil {
+		t.Fatalf("openDocumentState() error = %v", err)
+	}
+
+	if state.get("d1") == nil {
+		t.Errorf("openDocumentState() = %+v, want the legacy state", state.Documents)
+	}
+
+	if err = state.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(root, ".git", documentStateFile)); err != nil {
+		t.Errorf("state wasn't saved to the git directory: %v", err)
+	}
+
+	// Once saved there, the legacy state file is ignored.
+	state.delete("d1")
+	if err = state.save(); err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	if state, err = openDocumentState(root, repo); err != nil || state.get("d1") != nil {
+		t.Errorf("openDocumentState() = (%+v, %v), want the state from the git directory", state.Documents, err)
+	}
+}
+
+func TestRunDocumentExportIncremental(t *testing.T) {
+	root := t.TempDir()
+	setFlags(t, "--mode", modeDocuments, "--format", "markdown", "--export-path", root)
+
+	var (
+		mu      sync.Mutex
+		updated = map[string]string{"d1": "2026-10-01T00:00:00Z", "d2": "2026-10-01T00:00:00Z"}
+		exports []string
+	)
+
+	client := newTestClient(t, map[string]func(map[string]any) any{
+		"/collections.list": func(map[string]any) any {
+			return map[string]any{"data": []map[string]any{{"id": "c1", "name": "Engineering", "permission": "read_write"}}}
+		},
+		"/collections.documents": func(map[string]any) any {
+			mu.Lock()
+			defer mu.Unlock()
+
+			var nodes []map[string]any
+			for _, id := range slices.Sorted(maps.Keys(updated)) {
+				nodes = append(nodes, map[string]any{"id": id, "title": id})
+			}
+			return map[string]any{"data": nodes}
+		},
+		"/documents.list": func(map[string]any) any {
+			mu.Lock()
+			defer mu.Unlock()
+
+			var docs []map[string]any
+			for _, id := range slices.Sorted(maps.Keys(updated)) {
+				docs = append(docs, map[string]any{"id": id, "title": id, "collectionId": "c1", "updatedAt": updated[id]})
+			}
+			return map[string]any{"data": docs}
+		},
+		"/documents.export": func(body map[string]any) any {
+			mu.Lock()
+			defer mu.Unlock()
+
+			id := body["id"].(string)
+			exports = append(exports, id)
+			return map[string]any{"data": "# " + id + " " + updated[id]}
+		},
+	})
+
+	tests := []struct {
+		name        string
+		update      func(updated map[string]string)
+		wantExports []string
+		wantFiles   []string
+	}{
+		{
+			name:        "initial",
+			wantExports: []string{"d1", "d2"},
+			wantFiles:   []string{"Engineering/d1.md", "Engineering/d2.md"},
+		},
+		{
+			name:      "unchanged",
+			wantFiles: []string{"Engineering/d1.md", "Engineering/d2.md"},
+		},
+		{
+			name: "updated-and-removed",
+			update: func(updated map[string]string) {
+				updated["d1"] = "2026-10-02T00:00:00Z"
+				delete(updated, "d2")
+			},
+			wantExports: []string{"d1"},
+			wantFiles:   []string{"Engineering/d1.md"},
+		},
+	}
+
+	// Each run depends on the state left behind by the previous one.
+	for _, tt := range tests {
+		mu.Lock()
+		if tt.update != nil {
+			tt.update(updated)
+		}
+		exports = nil
+		mu.Unlock()
+
+		if err := runDocumentExport(t.Context(), client, nil, nil, &runResult{}); err != nil {
+			t.Fatalf("%s: runDocumentExport() error = %v", tt.name, err)
+		}
+
+		mu.Lock()
+		got := slices.Sorted(slices.Values(exports))
+		mu.Unlock()
+
+		if !slices.Equal(got, tt.wantExports) {
+			t.Errorf("%s: exported %q, want %q", tt.name, got, tt.wantExports)
+		}
+
+		var files []string
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() || d.Name() == documentStateFile {
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			files = append(files, filepath.ToSlash(rel))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(files, tt.wantFiles) {
+			t.Errorf("%s: export path contains %q, want %q", tt.name, files, tt.wantFiles)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(root, "Engineering", "d1.md"))
+	if err != nil || string(b) != "# d1 2026-10-02T00:00:00Z" {
+		t.Errorf("d1.md = %q (error = %v), want the updated document", b, err)
+	}
+}
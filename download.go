@@ -0,0 +1,483 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+	"github.com/lrstanley/outline-export/internal/mirror"
+	"github.com/lrstanley/outline-export/internal/tracing"
+	"github.com/lrstanley/outline-export/internal/zipsafe"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// downloadExport downloads the export of the target, and either writes it to the
+// target path, or extracts it into the target path (when --extract is provided).
+// Files excluded by the filter (if any) are left out in both cases. If the
+// download fails (or is canceled), any partial output is removed.
+func downloadExport(
+	ctx context.Context,
+	client *api.Client,
+	target *exportTarget,
+	filter *exportFilter,
+	result *runResult,
+) (err error) {
+	operation, dst := target.operation, target.path
+	workspace := target.collection == nil
+
+	// Download the export.
+	reader, err := client.DownloadFileExport(ctx, operation.ID)
+	if reader != nil {
+		defer reader.Close()
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to download export: %w", err)
+	}
+
+	if !cli.Flags.Extract {
+		return writeArchive(ctx, reader, dst, filter, workspace, result)
+	}
+
+	// In mirror mode, the export is extracted into a staging directory, which
+	// replaces the target once the extraction completes. The previous contents of
+	// the target are only used to detect changes.
+	var prev *os.Root
+	final := dst
+
+	if cli.Flags.Mirror {
+		dst, err = mirror.Stage(final)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				_ = mirror.Discard(dst)
+			}
+		}()
+
+		if prev, err = os.OpenRoot(final); err == nil {
+			defer prev.Close() //nolint:errcheck
+		} else {
+			prev = nil
+		}
+	} else {
+		err = os.MkdirAll(dst, 0o700)
+		if err != nil {
+			return fmt.Errorf("failed to create export directory %q: %w", dst, err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(os.TempDir(), fmt.Sprintf("outline-export-%s-*.zip", operation.ID))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	defer tmp.Close()           //nolint:errcheck
+
+	length, err := io.Copy(tmp, reader)
+	result.addBytes(length)
+	if err != nil {
+		return fmt.Errorf("failed to stream export to temporary file: %w", err)
+	}
+
+	zr, err := zip.NewReader(tmp, length)
+	if err != nil {
+		return fmt.Errorf("failed to create zip reader: %w", err)
+	}
+
+	limits := extractLimits()
+	if err = zipsafe.CheckLimits(zr, limits); err != nil {
+		return fmt.Errorf("export exceeds extraction limits (see --max-extract-files and --max-extract-size): %w", err)
+	}
+
+	// All filesystem operations go through root, so entries can never escape the
+	// export path (e.g. through symlinks which already exist within it).
+	root, err := os.OpenRoot(dst)
+	if err != nil {
+		return fmt.Errorf("failed to open export directory %q: %w", dst, err)
+	}
+	defer root.Close() //nolint:errcheck
+
+	// Track everything created by this extraction, so it can be removed if the
+	// extraction fails part way through.
+	var created []string
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		slices.Reverse(created)
+		for _, p := range created {
+			_ = root.Remove(p)
+		}
+	}()
+
+	entries, err := zipsafe.Entries(zr.File, newNameResolver(ctx), limits)
+	if err != nil {
+		return err
+	}
+
+	// Sanitized names of the entries extracted so far, and whether they are
+	// directories.
+	seen := make(map[string]bool, len(zr.File))
+	times := make(dirTimes)
+	var rejected int
+
+	for i, f := range zr.File {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		name, reason := entries[i].Name, entries[i].Reason
+		isDir := f.FileInfo().IsDir()
+
+		// Names which sanitize to the same path are resolved up front, so this only
+		// applies to duplicate entries within the archive.
+		if wasDir, ok := seen[name]; reason == "" && ok && (!isDir || !wasDir) {
+			reason = zipsafe.RejectCollision
+		}
+
+		if reason != "" {
+			slog.WarnContext(ctx, "rejecting unsafe zip entry", "entry", f.Name, "reason", reason)
+			result.addRejected(f.Name, reason)
+			rejected++
+			continue
+		}
+
+		if !filter.entry(entries[i].Path, isDir, workspace) {
+			slog.DebugContext(ctx, "skipping file/folder (excluded by filters)", "path", entries[i].Path)
+			if !isDir {
+				result.addSkipped("filter")
+			}
+			continue
+		}
+
+		var matched bool
+		if matched, err = filter.name(name); err != nil {
+			return err
+		} else if !matched {
+			slog.WarnContext(ctx, "skipping file/folder (does not match filter)", "path", name)
+			if !isDir {
+				result.addSkipped("filter")
+			}
+			continue
+		}
+
+		seen[name] = isDir
+		times.add(name, isDir, f.Modified)
+
+		var written bool
+		created, written, err = extractEntry(ctx, f, root, name, created)
+		if err != nil {
+			return err
+		}
+
+		if written {
+			result.addExtracted()
+
+			if prev == nil || !unchanged(f, prev, name) {
+				result.addChanged(1)
+			}
+		}
+	}
+
+	if rejected > 0 {
+		slog.WarnContext(ctx, "rejected unsafe zip entries", "count", rejected, "path", final)
+	}
+
+	// Directories are only updated once all files are written, as writing files
+	// changes the modification time of their directory.
+	if err = times.apply(root, ""); err != nil {
+		return err
+	}
+
+	if !cli.Flags.Mirror {
+		return nil
+	}
+
+	if prev != nil {
+		var stale []string
+		stale, err = staleFiles(prev, seen)
+		if err != nil {
+			return fmt.Errorf("failed to find stale files in %q: %w", final, err)
+		}
+
+		for _, name := range stale {
+			slog.InfoContext(ctx, "removing stale file", "path", name)
+		}
+		result.addChanged(len(stale))
+	}
+
+	// Close the staging directory before moving it into place.
+	_ = root.Close()
+
+	if err = mirror.Swap(dst, final); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "export mirrored", "path", final)
+	return nil
+}
+
+// staleFiles returns the files within root which aren't in seen (i.e. weren't
+// part of the export).
+func staleFiles(root *os.Root, seen map[string]bool) ([]string, error) {
+	var stale []string
+
+	err := fs.WalkDir(root.FS(), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		name := filepath.FromSlash(p)
+		if _, ok := seen[name]; !ok {
+			stale = append(stale, name)
+		}
+		return nil
+	})
+	return stale, err
+}
+
+// extractEntry extracts a single zip entry (file or directory) to name within
+// root, returning the updated list of created paths, and if a file was written
+// (files which are unchanged from a previous export are left as-is).
+func extractEntry(ctx context.Context, f *zip.File, root *os.Root, name string, created []string) (_ []string, written bool, err error) {
+	_, span := tracing.Start(ctx, "extract", trace.WithAttributes(
+		attribute.String("outline.path", name),
+		attribute.Int64("outline.size", int64(f.UncompressedSize64)), //nolint:gosec
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if f.FileInfo().IsDir() {
+		slog.InfoContext(ctx, "creating directory", "path", name)
+
+		created, err = mkdirAllTracked(root, name, created)
+		if err != nil {
+			return created, false, fmt.Errorf("failed to create directory %q: %w", name, err)
+		}
+		return created, false, nil
+	}
+
+	if unchanged(f, root, name) {
+		slog.DebugContext(ctx, "skipping file (unchanged)", "path", name)
+		return created, false, applyMetadata(root, name, false, f.Modified)
+	}
+
+	slog.InfoContext(ctx, "creating file", "path", name)
+
+	created, err = mkdirAllTracked(root, filepath.Dir(name), created)
+	if err != nil {
+		return created, false, fmt.Errorf("failed to create parent dirs for %q: %w", name, err)
+	}
+
+	created, err = extractFile(f, root, name, created)
+	if err != nil {
+		return created, false, fmt.Errorf("failed to extract file %q: %w", name, err)
+	}
+	return created, true, applyMetadata(root, name, false, f.Modified)
+}
+
+// unchanged returns true if name (within root) is a regular file with the same
+// size and CRC-32 checksum as the zip entry.
+func unchanged(f *zip.File, root *os.Root, name string) bool {
+	info, err := root.Lstat(name)
+	if err != nil || !info.Mode().IsRegular() || uint64(info.Size()) != f.UncompressedSize64 { //nolint:gosec
+		return false
+	}
+
+	df, err := root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer df.Close() //nolint:errcheck
+
+	h := crc32.NewIEEE()
+	if _, err = io.Copy(h, df); err != nil {
+		return false
+	}
+	return h.Sum32() == f.CRC32
+}
+
+// writeArchive writes the export archive to dst, leaving out any entries which
+// are excluded by the filter. The archive is written to a temporary file next to
+// dst first, so dst is only replaced once the download completes.
+func writeArchive(
+	ctx context.Context,
+	reader io.Reader,
+	dst string,
+	filter *exportFilter,
+	workspace bool,
+	result *runResult,
+) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create export directory %q: %w", dst, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.partial")
+	if err != nil {
+		return fmt.Errorf("failed to initialize export file %q: %w", dst, err)
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	n, err := io.Copy(f, reader)
+	result.addBytes(n)
+	result.addChanged(1)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to copy export to file %q: %w", dst, err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to write export file %q: %w", dst, err)
+	}
+
+	if filter.hasRules() {
+		if err = filterArchive(ctx, f.Name(), filter, workspace, result); err != nil {
+			return err
+		}
+	}
+
+	if err = applyMetadata(osFS{}, f.Name(), false, time.Time{}); err != nil {
+		return err
+	}
+
+	if err = os.Rename(f.Name(), dst); err != nil {
+		return fmt.Errorf("failed to move export file into place %q: %w", dst, err)
+	}
+
+	slog.InfoContext(ctx, "export file written", "file", dst)
+	return nil
+}
+
+// filterArchive rewrites the archive at name, leaving out any entries which are
+// excluded by the filter. Entries are copied as-is, without recompressing them.
+func filterArchive(ctx context.Context, name string, filter *exportFilter, workspace bool, result *runResult) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return fmt.Errorf("failed to open export file %q: %w", name, err)
+	}
+	defer zr.Close() //nolint:errcheck
+
+	out, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.filtered")
+	if err != nil {
+		return fmt.Errorf("failed to initialize filtered export file: %w", err)
+	}
+	defer os.Remove(out.Name()) //nolint:errcheck
+	defer out.Close()           //nolint:errcheck
+
+	zw := zip.NewWriter(out)
+	if err = zw.SetComment(zr.Comment); err != nil {
+		return fmt.Errorf("failed to write filtered export file: %w", err)
+	}
+
+	var skipped int
+
+	for _, f := range zr.File {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		parts, err := zipsafe.UnescapeParts(f.Name)
+		if err != nil {
+			return err
+		}
+
+		isDir := f.FileInfo().IsDir()
+		if path := strings.Trim(strings.Join(parts, "/"), "/"); !filter.entry(path, isDir, workspace) {
+			slog.DebugContext(ctx, "skipping file/folder (excluded by filters)", "path", path)
+			if !isDir {
+				result.addSkipped("filter")
+				skipped++
+			}
+			continue
+		}
+
+		if err = zw.Copy(f); err != nil {
+			return fmt.Errorf("failed to copy %q to filtered export file: %w", f.Name, err)
+		}
+	}
+
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("failed to write filtered export file: %w", err)
+	}
+
+	if err = out.Close(); err != nil {
+		return fmt.Errorf("failed to write filtered export file: %w", err)
+	}
+
+	_ = zr.Close()
+
+	if err = os.Rename(out.Name(), name); err != nil {
+		return fmt.Errorf("failed to replace export file with filtered export file: %w", err)
+	}
+
+	slog.InfoContext(ctx, "filtered export file", "skipped", skipped)
+	return nil
+}
+
+// mkdirAllTracked is like [os.Root.MkdirAll], but appends any directories which
+// it created to created.
+func mkdirAllTracked(root *os.Root, dir string, created []string) ([]string, error) {
+	var missing []string
+	for p := dir; p != "."; p = filepath.Dir(p) {
+		if _, err := root.Stat(p); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		missing = append(missing, p)
+	}
+
+	if err := root.MkdirAll(dir, 0o700); err != nil {
+		return created, err
+	}
+
+	slices.Reverse(missing)
+	return append(created, missing...), nil
+}
+
+// extractFile writes a single zip entry to name within root, appending name to
+// created if it did not exist before.
+func extractFile(f *zip.File, root *os.Root, name string, created []string) ([]string, error) {
+	inf, err := f.Open()
+	if err != nil {
+		return created, err
+	}
+	defer inf.Close() //nolint:errcheck
+
+	if _, err = root.Lstat(name); errors.Is(err, os.ErrNotExist) {
+		created = append(created, name)
+	}
+
+	outf, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return created, err
+	}
+
+	if _, err = io.Copy(outf, inf); err != nil {
+		_ = outf.Close()
+		return created, err
+	}
+
+	return created, outf.Close()
+}
@@ -0,0 +1,373 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+)
+
+// writeTree writes the provided files (slash-separated relative paths to
+// contents) within dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("failed to create parent dirs of %q: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %q: %v", name, err)
+		}
+	}
+}
+
+// readTree returns the contents of all files within dir, by slash-separated path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+
+	err := fs.WalkDir(os.DirFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+		files[p] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to read %q: %v", dir, err)
+	}
+	return files
+}
+
+// zipArchive returns a zip archive containing the provided files, in sorted order.
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatalf("failed to create zip entry %q: %v", name, err)
+		}
+
+		if _, err = w.Write([]byte(files[name])); err != nil {
+			t.Fatalf("failed to write zip entry %q: %v", name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to write zip archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// newDownloadClient returns a client for a test server, which responds to
+// export downloads with the provided archive.
+func newDownloadClient(t *testing.T, archive []byte) *api.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/fileOperations.redirect" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		_, _ = w.Write(archive)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := api.NewClient(&api.Config{
+		BaseURL: srv.URL,
+		Token:   "tok",
+		Retry:   &api.RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client
+}
+
+func TestStaleFiles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		existing map[string]string
+		seen     map[string]bool
+		want     []string
+	}{
+		{
+			name:     "none",
+			existing: map[string]string{"a.md": "a", "sub/b.md": "b"},
+			seen:     map[string]bool{"a.md": false, "sub": true, filepath.Join("sub", "b.md"): false},
+		},
+		{
+			name:     "stale",
+			existing: map[string]string{"a.md": "a", "old.md": "x", "sub/b.md": "b", "gone/c.md": "c"},
+			seen:     map[string]bool{"a.md": false, "sub": true, filepath.Join("sub", "b.md"): false},
+			want:     []string{filepath.Join("gone", "c.md"), "old.md"},
+		},
+		{
+			name:     "empty-export",
+			existing: map[string]string{"a.md": "a"},
+			seen:     map[string]bool{},
+			want:     []string{"a.md"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			writeTree(t, dir, tt.existing)
+
+			root, err := os.OpenRoot(dir)
+			if err != nil {
+				t.Fatalf("failed to open root: %v", err)
+			}
+			t.Cleanup(func() { _ = root.Close() })
+
+			got, err := staleFiles(root, tt.seen)
+			if err != nil {
+				t.Fatalf("staleFiles() error = %v", err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("staleFiles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadExportExtract(t *testing.T) {
+	archive := map[string]string{"Engineering/a.md": "a", "Engineering/sub/b.md": "b"}
+
+	tests := []struct {
+		name          string
+		args          []string
+		existing      map[string]string // Nil if the export path doesn't exist yet.
+		archive       map[string]string
+		want          map[string]string
+		wantExtracted int
+		wantChanged   int
+		wantSkipped   int
+	}{
+		{
+			name:          "new",
+			args:          []string{"--extract"},
+			archive:       archive,
+			want:          archive,
+			wantExtracted: 2,
+			wantChanged:   2,
+		},
+		{
+			name:          "unchanged-and-stale",
+			args:          []string{"--extract"},
+			existing:      map[string]string{"Engineering/a.md": "a", "stale.md": "x"},
+			archive:       archive,
+			want:          map[string]string{"Engineering/a.md": "a", "Engineering/sub/b.md": "b", "stale.md": "x"},
+			wantExtracted: 1,
+			wantChanged:   1,
+		},
+		{
+			name:          "filtered",
+			args:          []string{"--extract", "--exclude", "sub/"},
+			archive:       archive,
+			want:          map[string]string{"Engineering/a.md": "a"},
+			wantExtracted: 1,
+			wantChanged:   1,
+			wantSkipped:   1,
+		},
+		{
+			name:          "mirror-new",
+			args:          []string{"--extract", "--mirror"},
+			archive:       archive,
+			want:          archive,
+			wantExtracted: 2,
+			wantChanged:   2,
+		},
+		{
+			// Unchanged files are written to the staging directory, but aren't
+			// counted as changed. Removed files are.
+			name:          "mirror-stale",
+			args:          []string{"--extract", "--mirror"},
+			existing:      map[string]string{"Engineering/a.md": "a", "stale.md": "x", "gone/c.md": "c"},
+			archive:       archive,
+			want:          archive,
+			wantExtracted: 2,
+			wantChanged:   3,
+		},
+		{
+			name:          "mirror-modified",
+			args:          []string{"--extract", "--mirror"},
+			existing:      map[string]string{"Engineering/a.md": "old", "Engineering/sub/b.md": "b"},
+			archive:       archive,
+			want:          archive,
+			wantExtracted: 2,
+			wantChanged:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "out")
+
+			flags := setFlags(t, append([]string{"--format", "markdown", "--export-path", dst}, tt.args...)...)
+
+			if tt.existing != nil {
+				writeTree(t, dst, tt.existing)
+			}
+
+			filter, err := newExportFilter(flags)
+			if err != nil {
+				t.Fatalf("newExportFilter() error = %v", err)
+			}
+
+			data := zipArchive(t, tt.archive)
+			target := &exportTarget{
+				format:    api.ExportFormatMarkdown,
+				path:      dst,
+				operation: &api.FileOperation{ID: "op1"},
+			}
+			result := &runResult{}
+
+			if err = downloadExport(t.Context(), newDownloadClient(t, data), target, filter, result); err != nil {
+				t.Fatalf("downloadExport() error = %v", err)
+			}
+
+			if got := readTree(t, dst); !maps.Equal(got, tt.want) {
+				t.Errorf("downloadExport() wrote %q, want %q", got, tt.want)
+			}
+
+			if result.BytesDownloaded != int64(len(data)) || result.FilesExtracted != tt.wantExtracted ||
+				result.Changes != tt.wantChanged || result.FilesSkipped != tt.wantSkipped {
+				t.Errorf(
+					"downloadExport() result = %+v, want %d bytes, %d extracted, %d changed, %d skipped",
+					result, len(data), tt.wantExtracted, tt.wantChanged, tt.wantSkipped,
+				)
+			}
+
+			// The staging directory isn't left behind.
+			if got, _ := os.ReadDir(parent); len(got) != 1 {
+				t.Errorf("downloadExport() left %d entries next to the export path, want 1", len(got))
+			}
+		})
+	}
+}
+
+func TestDownloadExportMirrorFailure(t *testing.T) {
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "out")
+	existing := map[string]string{"Engineering/a.md": "a", "stale.md": "x"}
+	writeTree(t, dst, existing)
+
+	setFlags(t, "--format", "markdown", "--export-path", dst, "--extract", "--mirror")
+
+	target := &exportTarget{format: api.ExportFormatMarkdown, path: dst, operation: &api.FileOperation{ID: "op1"}}
+
+	err := downloadExport(t.Context(), newDownloadClient(t, []byte("not a zip archive")), target, nil, &runResult{})
+	if err == nil {
+		t.Fatal("downloadExport() error = nil, want an error for an invalid archive")
+	}
+
+	// The previous export is left as-is, and the staging directory is removed.
+	if got := readTree(t, dst); !maps.Equal(got, existing) {
+		t.Errorf("downloadExport() left %q, want %q", got, existing)
+	}
+
+	if got, _ := os.ReadDir(parent); len(got) != 1 {
+		t.Errorf("downloadExport() left %d entries next to the export path, want 1", len(got))
+	}
+}
+
+func TestDownloadExportArchive(t *testing.T) {
+	data := zipArchive(t, map[string]string{"Engineering/a.md": "a", "Engineering/sub/b.md": "b"})
+
+	tests := []struct {
+		name        string
+		args        []string
+		want        []string // Entries of the written archive.
+		wantSkipped int
+		wantAsIs    bool // If the archive should be written byte-for-byte.
+	}{
+		{name: "as-is", want: []string{"Engineering/a.md", "Engineering/sub/b.md"}, wantAsIs: true},
+		{name: "legacy-filters", args: []string{"--filters", "Engineering/a.md"}, want: []string{"Engineering/a.md", "Engineering/sub/b.md"}, wantAsIs: true},
+		{name: "filtered", args: []string{"--exclude", "sub/"}, want: []string{"Engineering/a.md"}, wantSkipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "export.zip")
+
+			flags := setFlags(t, append([]string{"--format", "markdown", "--export-path", dst}, tt.args...)...)
+
+			filter, err := newExportFilter(flags)
+			if err != nil {
+				t.Fatalf("newExportFilter() error = %v", err)
+			}
+
+			target := &exportTarget{format: api.ExportFormatMarkdown, path: dst, operation: &api.FileOperation{ID: "op1"}}
+			result := &runResult{}
+
+			if err = downloadExport(t.Context(), newDownloadClient(t, data), target, filter, result); err != nil {
+				t.Fatalf("downloadExport() error = %v", err)
+			}
+
+			written, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatalf("failed to read written archive: %v", err)
+			}
+
+			if got := bytes.Equal(written, data); got != tt.wantAsIs {
+				t.Errorf("downloadExport() wrote the archive as-is = %t, want %t", got, tt.wantAsIs)
+			}
+
+			zr, err := zip.NewReader(bytes.NewReader(written), int64(len(written)))
+			if err != nil {
+				t.Fatalf("failed to read written archive: %v", err)
+			}
+
+			var got []string
+			for _, f := range zr.File {
+				got = append(got, f.Name)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("downloadExport() wrote entries %q, want %q", got, tt.want)
+			}
+
+			if result.Changes != 1 || result.FilesSkipped != tt.wantSkipped {
+				t.Errorf("downloadExport() result = %+v, want 1 change and %d skipped", result, tt.wantSkipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lrstanley/outline-export/internal/zipsafe"
+)
+
+// rejectedEntry is a zip entry which was not extracted, as it's unsafe.
+type rejectedEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// addRejected records a zip entry which was rejected for the given reason.
+func (r *runResult) addRejected(path, reason string) {
+	r.Rejected = append(r.Rejected, &rejectedEntry{Path: path, Reason: reason})
+	r.addSkipped(reason)
+}
+
+// byteSize is a size in bytes, which can be provided with a unit suffix (e.g.
+// "512MiB", "10GB", or "1024").
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+func (s *byteSize) UnmarshalText(text []byte) error {
+	v := strings.TrimSpace(string(text))
+	mult := int64(1)
+
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(v, unit.suffix) {
+			v, mult = strings.TrimSpace(strings.TrimSuffix(v, unit.suffix)), unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q (e.g. 512MiB, 10GB, or 1024)", string(text))
+	}
+
+	*s = byteSize(n * mult)
+	return nil
+}
+
+// String returns the size using the largest unit which represents it exactly.
+func (s byteSize) String() string {
+	if s == 0 {
+		return "0"
+	}
+
+	best := byteUnits[len(byteUnits)-1]
+	for _, unit := range byteUnits {
+		if int64(s)%unit.size == 0 && unit.size > best.size {
+			best = unit
+		}
+	}
+	return strconv.FormatInt(int64(s)/best.size, 10) + best.suffix
+}
+
+// extractLimits returns the extraction limits, based on the --max-extract-*
+// and --max-compression-ratio flags.
+func extractLimits() zipsafe.Limits {
+	return zipsafe.Limits{
+		MaxFiles: cli.Flags.MaxExtractFiles,
+		MaxSize:  int64(cli.Flags.MaxExtractSize),
+		MaxRatio: cli.Flags.MaxCompressionRatio,
+	}
+}
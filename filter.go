@@ -0,0 +1,105 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lrstanley/outline-export/internal/pathfilter"
+)
+
+// exportFilter filters the collections and files included in an export, based
+// on the --include, --exclude, --include-collection and --exclude-collection
+// flags (and the deprecated --filters flag).
+type exportFilter struct {
+	paths       *pathfilter.Filter
+	collections *pathfilter.Filter
+
+	// legacy are the patterns of the deprecated --filters flag, which are
+	// matched against sanitized names using [filepath.Match] (extract mode only).
+	legacy []string
+}
+
+// newExportFilter returns the filter based on the provided flags, or nil if no
+// rules are configured.
+func newExportFilter(f *Flags) (*exportFilter, error) {
+	filter := &exportFilter{}
+	var err error
+
+	if len(f.Include) > 0 || len(f.Exclude) > 0 {
+		filter.paths, err = pathfilter.New(f.Include, f.Exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(f.IncludeCollections) > 0 || len(f.ExcludeCollections) > 0 {
+		filter.collections, err = pathfilter.NewNames(f.IncludeCollections, f.ExcludeCollections)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(f.Filters) > 0 {
+		filter.legacy = f.Filters
+	}
+
+	if filter.paths == nil && filter.collections == nil && filter.legacy == nil {
+		return nil, nil //nolint:nilnil
+	}
+	return filter, nil
+}
+
+// hasRules reports whether any path or collection rules are configured. The
+// deprecated --filters patterns aren't included, as they only apply when
+// extracting.
+func (f *exportFilter) hasRules() bool {
+	return f != nil && (f.paths != nil || f.collections != nil)
+}
+
+// collection reports whether the collection with the provided name should be
+// exported.
+func (f *exportFilter) collection(name string) bool {
+	return f == nil || f.collections.Match(name, false)
+}
+
+// entry reports whether the file or directory at path (slash-separated, and not
+// yet sanitized) should be included. In workspace exports, the first part of the
+// path is the name of the collection, which is also matched against the
+// collection rules.
+func (f *exportFilter) entry(path string, dir, workspace bool) bool {
+	if f == nil {
+		return true
+	}
+
+	if workspace {
+		if name, _, ok := strings.Cut(path, "/"); (ok || dir) && !f.collections.Match(name, true) {
+			return false
+		}
+	}
+	return f.paths.Match(path, dir)
+}
+
+// name reports whether the file or directory with the provided sanitized name
+// (relative to the extraction directory) matches the deprecated --filters
+// patterns, if any.
+func (f *exportFilter) name(name string) (bool, error) {
+	if f == nil || len(f.legacy) == 0 {
+		return true, nil
+	}
+
+	for _, pattern := range f.legacy {
+		matched, err := filepath.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid filter pattern %q: %w", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/lrstanley/outline-export/internal/gitrepo"
+)
+
+// openGitRepo opens (or initializes) the git repository at the export path.
+func openGitRepo() (*gitrepo.Repo, error) {
+	return gitrepo.Open(&gitrepo.Options{
+		Path:        cli.Flags.ExportPath,
+		Branch:      cli.Flags.GitBranch,
+		AuthorName:  cli.Flags.GitAuthorName,
+		AuthorEmail: cli.Flags.GitAuthorEmail,
+		RemoteURL:   cli.Flags.GitPushRemote,
+	})
+}
+
+// commitGitSnapshot commits all changes in the export path, and pushes them to
+// the configured remote (if any). The commit message includes the export
+// details, and the number of changed files. As the working tree is replaced on
+// each export, the committed changes replace any changes already counted in the
+// result.
+func commitGitSnapshot(ctx context.Context, repo *gitrepo.Repo, targets []*exportTarget, result *runResult) error {
+	formats := strings.Join(result.Formats, ", ")
+
+	hash, changes, err := repo.Commit(func(changes gitrepo.Changes) string {
+		var sb strings.Builder
+
+		fmt.Fprintf(
+			&sb, "outline export (%s): %d added, %d modified, %d deleted\n\n",
+			formats, changes.Added, changes.Modified, changes.Deleted,
+		)
+		fmt.Fprintf(&sb, "Mode: %s\n", cli.Flags.Mode)
+		fmt.Fprintf(&sb, "Format: %s\n", formats)
+
+		for _, target := range targets {
+			if target.operation == nil {
+				continue
+			}
+
+			if target.collection != nil {
+				fmt.Fprintf(&sb, "File-Operation: %s (%s, collection: %s)\n", target.operation.ID, target.format, target.collection.Name)
+			} else {
+				fmt.Fprintf(&sb, "File-Operation: %s (%s)\n", target.operation.ID, target.format)
+			}
+		}
+
+		return sb.String()
+	})
+	if err != nil {
+		return err
+	}
+
+	result.Changes = changes.Total()
+
+	if hash == "" {
+		slog.InfoContext(ctx, "no changes to commit")
+	} else {
+		slog.InfoContext(
+			ctx, "export committed",
+			"commit", hash,
+			"added", changes.Added,
+			"modified", changes.Modified,
+			"deleted", changes.Deleted,
+		)
+	}
+
+	if cli.Flags.GitPushRemote == "" {
+		return nil
+	}
+
+	if err = repo.Push(ctx); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "export pushed", "remote", cli.Flags.GitPushRemote, "branch", cli.Flags.GitBranch)
+	return nil
+}
@@ -16,6 +16,11 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lrstanley/outline-export/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -24,27 +29,70 @@ const (
 )
 
 type Config struct {
-	BaseURL     string
-	Token       string
-	Logger      *slog.Logger
+	BaseURL         string
+	Token           string
+	Logger          *slog.Logger
 	RewriteRedirect bool
-	HTTPTimeout time.Duration
+	HTTPTimeout     time.Duration
+
+	// Retry configures how failed requests are retried. Defaults to
+	// [DefaultRetryPolicy] if nil.
+	Retry *RetryPolicy
+
+	// CAFile is a PEM bundle of additional certificate authorities to trust, on
+	// top of the system certificate pool.
+	CAFile string
+
+	// ClientCertFile and ClientKeyFile are the PEM certificate and key presented
+	// to servers which require client certificates (mTLS).
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// MinTLSVersion is the minimum TLS version (e.g. [tls.VersionTLS13]).
+	// Defaults to [DefaultMinTLSVersion].
+	MinTLSVersion uint16
+
+	// ProxyURL is the proxy used for all requests. Defaults to the proxy from the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL string
+
+	// InsecureSkipVerify disables verification of server certificates. This
+	// should only be used for testing.
+	InsecureSkipVerify bool
 }
 
 type Client struct {
 	HTTPClient *http.Client
 	Config     *Config
+
+	headers   http.Header
+	userAgent string
+	hooks     Hooks
 }
 
-func NewClient(config *Config) (*Client, error) {
+// NewClient returns a new client, based on the provided config and options.
+func NewClient(config *Config, opts ...Option) (*Client, error) {
 	if config == nil {
 		config = &Config{}
 	}
 
+	o := &options{userAgent: DefaultUserAgent, hooks: noopHooks{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	if config.HTTPTimeout == 0 {
 		config.HTTPTimeout = DefaultHTTPTimeout
 	}
 
+	if config.Retry == nil {
+		config.Retry = DefaultRetryPolicy()
+	}
+
+	if config.Retry.MaxAttempts < 1 {
+		config.Retry.MaxAttempts = 1
+	}
+
 	if config.Logger == nil {
 		config.Logger = slog.Default()
 	}
@@ -59,17 +107,91 @@ func NewClient(config *Config) (*Client, error) {
 		return nil, errors.New("token is required")
 	}
 
+	if config.MinTLSVersion == 0 {
+		config.MinTLSVersion = DefaultMinTLSVersion
+	}
+
+	transport := o.transport
+	if transport == nil {
+		var err error
+		transport, err = newTransport(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := len(o.middleware) - 1; i >= 0; i-- {
+		transport = o.middleware[i](transport)
+	}
+
 	client := Client{
 		HTTPClient: &http.Client{
-			Timeout: config.HTTPTimeout,
+			Timeout:   config.HTTPTimeout,
+			Transport: otelhttp.NewTransport(transport),
 		},
-		Config: config,
+		Config:    config,
+		headers:   o.headers,
+		userAgent: o.userAgent,
+		hooks:     o.hooks,
 	}
 	client.HTTPClient.CheckRedirect = client.checkRedirect
 
 	return &client, nil
 }
 
+// redactedToken replaces the token in logs and errors.
+const redactedToken = "[REDACTED]"
+
+// redact replaces occurrences of the token in s, so it's never included in logs
+// or errors (e.g. when echoed back in an error body).
+func (c *Client) redact(s string) string {
+	return redactToken(s, c.Config.Token)
+}
+
+// redactToken replaces occurrences of token in s which aren't part of a longer
+// word, so short tokens don't mangle unrelated text (e.g. the token "t" within
+// "http").
+func redactToken(s, token string) string {
+	if token == "" {
+		return s
+	}
+
+	var b strings.Builder
+	var last int
+
+	for offset := 0; ; {
+		i := strings.Index(s[offset:], token)
+		if i < 0 {
+			break
+		}
+
+		start := offset + i
+		end := start + len(token)
+		offset = start + 1
+
+		if (start > 0 && isTokenByte(s[start-1])) || (end < len(s) && isTokenByte(s[end])) {
+			continue
+		}
+
+		b.WriteString(s[last:start])
+		b.WriteString(redactedToken)
+		last = end
+		offset = end
+	}
+
+	if last == 0 {
+		return s
+	}
+
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// isTokenByte returns true if c can be part of a token.
+func isTokenByte(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
 func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
 	if !c.Config.RewriteRedirect {
 		return nil
@@ -87,7 +209,17 @@ func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
 // GenerateExport generates an export of all collections. Note that it will likely
 // be pending once returned, and you should poll until it's ready. See
 // [WaitForFileOperation] and [GenerateExportAndWait] for more information.
-func (c *Client) GenerateExport(ctx context.Context, format ExportFormat, includeAttachments bool, includePrivate bool) (*FileOperation, error) {
+//
+// As each call creates a new file operation, it is only retried if the request
+// never reached the server.
+func (c *Client) GenerateExport(ctx context.Context, format ExportFormat, includeAttachments bool, includePrivate bool) (op *FileOperation, err error) {
+	ctx, span := tracing.Start(ctx, "GenerateExport", trace.WithAttributes(
+		attribute.String("outline.format", string(format)),
+		attribute.Bool("outline.include_attachments", includeAttachments),
+		attribute.Bool("outline.include_private", includePrivate),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	type Response struct {
 		Data struct {
 			FileOperation *FileOperation `json:"fileOperation"`
@@ -109,6 +241,38 @@ func (c *Client) GenerateExport(ctx context.Context, format ExportFormat, includ
 	return r.Data.FileOperation, nil
 }
 
+// GenerateCollectionExport generates an export of a single collection. Like
+// [GenerateExport], it will likely be pending once returned, and it is only
+// retried if the request never reached the server.
+func (c *Client) GenerateCollectionExport(ctx context.Context, collectionID string, format ExportFormat, includeAttachments bool) (op *FileOperation, err error) {
+	ctx, span := tracing.Start(ctx, "GenerateCollectionExport", trace.WithAttributes(
+		attribute.String("outline.collection_id", collectionID),
+		attribute.String("outline.format", string(format)),
+		attribute.Bool("outline.include_attachments", includeAttachments),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	type Response struct {
+		Data struct {
+			FileOperation *FileOperation `json:"fileOperation"`
+		} `json:"data"`
+	}
+	r, err := request[*Response](
+		ctx, c, http.MethodPost,
+		"/collections.export",
+		nil,
+		map[string]any{
+			"id":                 collectionID,
+			"format":             format,
+			"includeAttachments": includeAttachments,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r.Data.FileOperation, nil
+}
+
 // GenerateExportAndWait generates an export of all collections and waits for it to complete.
 func (c *Client) GenerateExportAndWait(ctx context.Context, format ExportFormat, includeAttachments bool, includePrivate bool) (*FileOperation, error) {
 	op, err := c.GenerateExport(ctx, format, includeAttachments, includePrivate)
@@ -118,14 +282,24 @@ func (c *Client) GenerateExportAndWait(ctx context.Context, format ExportFormat,
 	return c.WaitForFileOperation(ctx, op.ID)
 }
 
-// DownloadFileExport downloads a file export.
+// DownloadFileExport downloads a file export. The returned span (when tracing
+// is enabled) covers the full download, and ends once the reader is closed.
 func (c *Client) DownloadFileExport(ctx context.Context, id string) (io.ReadCloser, error) {
-	return requestStream(
+	ctx, span := tracing.Start(ctx, "DownloadFileExport", trace.WithAttributes(
+		attribute.String("outline.file_operation_id", id),
+	))
+
+	rc, err := requestStream(
 		ctx, c, http.MethodGet,
 		"/fileOperations.redirect",
 		map[string]string{"id": id},
 		nil,
 	)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	return &spanReader{ReadCloser: rc, span: span}, nil
 }
 
 // GetFileOperation fetches a specific file operation.
@@ -173,8 +347,13 @@ func (c *Client) ListFileOperations(ctx context.Context) iter.Seq2[*FileOperatio
 		count := 0
 
 		for {
+			pctx, span := tracing.Start(ctx, "ListFileOperations page", trace.WithAttributes(
+				attribute.Int("outline.limit", limit),
+				attribute.Int("outline.offset", offset),
+			))
+
 			r, err := request[*Response](
-				ctx, c, http.MethodPost,
+				pctx, c, http.MethodPost,
 				"/fileOperations.list",
 				nil,
 				map[string]any{
@@ -183,6 +362,7 @@ func (c *Client) ListFileOperations(ctx context.Context) iter.Seq2[*FileOperatio
 					"type":   "export",
 				},
 			)
+			tracing.End(span, err)
 			if err != nil {
 				yield(nil, err)
 				return
@@ -205,11 +385,195 @@ func (c *Client) ListFileOperations(ctx context.Context) iter.Seq2[*FileOperatio
 	}
 }
 
+// pollFileOperation fetches the file operation, as a single poll of
+// [Client.WaitForFileOperation].
+func (c *Client) pollFileOperation(ctx context.Context, id string, poll int) (op *FileOperation, err error) {
+	ctx, span := tracing.Start(ctx, "WaitForFileOperation poll", trace.WithAttributes(
+		attribute.Int("outline.poll", poll),
+	))
+	defer func() {
+		if op != nil {
+			span.SetAttributes(attribute.String("outline.file_operation_state", string(op.State)))
+		}
+		tracing.End(span, err)
+	}()
+
+	return c.GetFileOperation(ctx, id)
+}
+
+// AuthInfo fetches the user and team the token belongs to.
+func (c *Client) AuthInfo(ctx context.Context) (*AuthInfo, error) {
+	type Response struct {
+		Data *AuthInfo `json:"data"`
+	}
+	r, err := request[*Response](
+		ctx, c, http.MethodPost,
+		"/auth.info",
+		nil,
+		map[string]any{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r.Data, nil
+}
+
+// GetCollection fetches a specific collection, by ID or url ID.
+func (c *Client) GetCollection(ctx context.Context, id string) (*Collection, error) {
+	type Response struct {
+		Data *Collection `json:"data"`
+	}
+	r, err := request[*Response](
+		ctx, c, http.MethodPost,
+		"/collections.info",
+		nil,
+		map[string]any{"id": id},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r.Data, nil
+}
+
+// ListCollections lists all collections the token has access to.
+func (c *Client) ListCollections(ctx context.Context) iter.Seq2[*Collection, error] {
+	type Response struct {
+		Pagination Pagination   `json:"pagination"`
+		Data       []Collection `json:"data"`
+	}
+
+	return func(yield func(*Collection, error) bool) {
+		limit := 25
+		offset := 0
+		count := 0
+
+		for {
+			r, err := request[*Response](
+				ctx, c, http.MethodPost,
+				"/collections.list",
+				nil,
+				map[string]any{
+					"limit":  strconv.Itoa(limit),
+					"offset": strconv.Itoa(offset),
+				},
+			)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for _, collection := range r.Data {
+				count++
+				if !yield(&collection, nil) {
+					return
+				}
+			}
+
+			if len(r.Data) < limit || (r.Pagination.Total > 0 && r.Pagination.Total <= count) {
+				return
+			}
+
+			offset += limit
+			time.Sleep(250 * time.Millisecond)
+		}
+	}
+}
+
+// GetCollectionStructure fetches the document structure (tree) of a collection.
+func (c *Client) GetCollectionStructure(ctx context.Context, collectionID string) ([]*NavigationNode, error) {
+	type Response struct {
+		Data []*NavigationNode `json:"data"`
+	}
+	r, err := request[*Response](
+		ctx, c, http.MethodPost,
+		"/collections.documents",
+		nil,
+		map[string]any{"id": collectionID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r.Data, nil
+}
+
+// ListDocuments lists all published documents in a collection, most recently
+// updated first.
+func (c *Client) ListDocuments(ctx context.Context, collectionID string) iter.Seq2[*Document, error] {
+	type Response struct {
+		Pagination Pagination `json:"pagination"`
+		Data       []Document `json:"data"`
+	}
+
+	return func(yield func(*Document, error) bool) {
+		limit := 25
+		offset := 0
+		count := 0
+
+		for {
+			r, err := request[*Response](
+				ctx, c, http.MethodPost,
+				"/documents.list",
+				nil,
+				map[string]any{
+					"collectionId": collectionID,
+					"sort":         "updatedAt",
+					"direction":    "DESC",
+					"limit":        strconv.Itoa(limit),
+					"offset":       strconv.Itoa(offset),
+				},
+			)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for _, document := range r.Data {
+				count++
+				if !yield(&document, nil) {
+					return
+				}
+			}
+
+			if len(r.Data) < limit || (r.Pagination.Total > 0 && r.Pagination.Total <= count) {
+				return
+			}
+
+			offset += limit
+			time.Sleep(250 * time.Millisecond)
+		}
+	}
+}
+
+// ExportDocument exports a single document as Markdown.
+func (c *Client) ExportDocument(ctx context.Context, id string) (string, error) {
+	type Response struct {
+		Data string `json:"data"`
+	}
+	r, err := request[*Response](
+		ctx, c, http.MethodPost,
+		"/documents.export",
+		nil,
+		map[string]any{"id": id},
+	)
+	if err != nil {
+		return "", err
+	}
+	return r.Data, nil
+}
+
 // WaitForFileOperation waits for a file operation to complete. Use a context
 // to cancel the operation if it takes too long.
-func (c *Client) WaitForFileOperation(ctx context.Context, id string) (*FileOperation, error) {
-	for {
-		op, err := c.GetFileOperation(ctx, id)
+func (c *Client) WaitForFileOperation(ctx context.Context, id string) (op *FileOperation, err error) {
+	ctx, span := tracing.Start(ctx, "WaitForFileOperation", trace.WithAttributes(
+		attribute.String("outline.file_operation_id", id),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	defer func() { c.hooks.FileOperationWaited(id, time.Since(start)) }()
+
+	for poll := 1; ; poll++ {
+		op, err = c.pollFileOperation(ctx, id, poll)
 		if err != nil {
 			return nil, err
 		}
@@ -222,8 +586,10 @@ func (c *Client) WaitForFileOperation(ctx context.Context, id string) (*FileOper
 		case FileOperationStateExpired:
 			return nil, errors.New("file operation expired")
 		case FileOperationStateCreating, FileOperationStateUploading:
-			slog.InfoContext(ctx, "waiting for file operation to complete", "state", op.State)
-			time.Sleep(2 * time.Second)
+			c.Config.Logger.InfoContext(ctx, "waiting for file operation to complete", "state", op.State)
+			if err = sleep(ctx, 2*time.Second); err != nil {
+				return nil, err
+			}
 			continue
 		default:
 			return nil, fmt.Errorf("unknown file operation state: %s", op.State)
@@ -0,0 +1,43 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package api
+
+import "testing"
+
+func TestRedactToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		in    string
+		token string
+		want  string
+	}{
+		{name: "empty-token", in: "Bearer abc", token: "", want: "Bearer abc"},
+		{name: "header", in: "Bearer ol_api_abc123", token: "ol_api_abc123", want: "Bearer [REDACTED]"},
+		{name: "query", in: "https://x/api?token=ol_api_abc123&a=b", token: "ol_api_abc123", want: "https://x/api?token=[REDACTED]&a=b"},
+		{name: "json", in: `{"token":"ol_api_abc123"}`, token: "ol_api_abc123", want: `{"token":"[REDACTED]"}`},
+		{name: "multiple", in: "ol_api_abc123 ol_api_abc123", token: "ol_api_abc123", want: "[REDACTED] [REDACTED]"},
+		{name: "whole", in: "ol_api_abc123", token: "ol_api_abc123", want: "[REDACTED]"},
+		{
+			name:  "short-token",
+			in:    "http://127.0.0.1/api/collections.export_all: t",
+			token: "t",
+			want:  "http://127.0.0.1/api/collections.export_all: [REDACTED]",
+		},
+		{name: "part-of-word", in: "ol_api_abc1234", token: "ol_api_abc123", want: "ol_api_abc1234"},
+		{name: "overlapping", in: "aaa aa", token: "aa", want: "aaa [REDACTED]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := redactToken(tt.in, tt.token); got != tt.want {
+				t.Errorf("redactToken(%q, %q) = %q, want %q", tt.in, tt.token, got, tt.want)
+			}
+		})
+	}
+}
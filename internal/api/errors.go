@@ -0,0 +1,139 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxErrorBodyLen is the maximum number of bytes of a non-JSON response body
+// (e.g. an HTML error page from a proxy) included in an [APIError].
+const maxErrorBodyLen = 256
+
+// maxErrorBodyRead is the maximum number of bytes read from the body of an error
+// response. It's a little more than [maxErrorBodyLen], so Outline error
+// envelopes can still be decoded, without reading large error pages entirely.
+const maxErrorBodyRead = 16 * maxErrorBodyLen
+
+// APIError is returned when the Outline API responds with a non-successful
+// status code. When possible, it contains the error envelope returned by Outline.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int `json:"status"`
+
+	// Code is the Outline error code (e.g. "authorization_required"), if any.
+	Code string `json:"error,omitempty"`
+
+	// Message is the human readable error message returned by Outline, if any.
+	// If the response didn't contain an Outline error envelope, this is the
+	// (truncated) response body instead.
+	Message string `json:"message,omitempty"`
+
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+
+	// Path is the API path of the request (e.g. "/collections.export_all").
+	Path string `json:"path"`
+
+	// RequestID is the request ID returned by the server, if any.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// newAPIError creates an [APIError] from the given response and its (already
+// read) body.
+func newAPIError(resp *http.Response, path string, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     resp.Request.Method,
+		Path:       path,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+	}
+
+	var envelope struct {
+		Ok      bool   `json:"ok"`
+		Error   string `json:"error"`
+		Message string `json:"message"`
+		Status  int    `json:"status"`
+	}
+
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		e.Code = envelope.Error
+		e.Message = envelope.Message
+		return e
+	}
+
+	e.Message = truncateBody(body)
+	return e
+}
+
+// truncateBody returns the body as a single line, truncated to
+// [maxErrorBodyLen] bytes without splitting multi-byte characters.
+func truncateBody(body []byte) string {
+	s := strings.Join(strings.Fields(strings.ToValidUTF8(string(body), "")), " ")
+	if len(s) <= maxErrorBodyLen {
+		return s
+	}
+
+	i := maxErrorBodyLen
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i] + "..."
+}
+
+func (e *APIError) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s %s: status %d", e.Method, e.Path, e.StatusCode)
+
+	if e.Code != "" {
+		sb.WriteString(" (" + e.Code + ")")
+	}
+
+	if e.Message != "" {
+		sb.WriteString(": " + e.Message)
+	}
+
+	if e.RequestID != "" {
+		sb.WriteString(" [request-id: " + e.RequestID + "]")
+	}
+
+	return sb.String()
+}
+
+// hasStatus returns true if the error is an [APIError] with the given status code.
+func hasStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// IsUnauthorized returns true if the error is an [APIError] indicating that the
+// token is missing, invalid, or expired.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden returns true if the error is an [APIError] indicating that the
+// token does not have permission to perform the request.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsNotFound returns true if the error is an [APIError] indicating that the
+// requested resource does not exist.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRateLimited returns true if the error is an [APIError] indicating that the
+// request was rate limited.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
@@ -0,0 +1,228 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// newTestResponse returns a response with the given status code, for a POST
+// request.
+func newTestResponse(code int, requestID string) *http.Response {
+	resp := &http.Response{
+		StatusCode: code,
+		Header:     http.Header{},
+		Request:    &http.Request{Method: http.MethodPost},
+	}
+
+	if requestID != "" {
+		resp.Header.Set("X-Request-Id", requestID)
+	}
+	return resp
+}
+
+func TestNewAPIError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		code      int
+		requestID string
+		body      string
+		want      APIError
+		wantErr   string
+	}{
+		{
+			name:      "envelope",
+			code:      http.StatusForbidden,
+			requestID: "abc",
+			body:      `{"ok":false,"error":"authorization_error","message":"Authorization error","status":403}`,
+			want: APIError{
+				StatusCode: http.StatusForbidden,
+				Code:       "authorization_error",
+				Message:    "Authorization error",
+				Method:     http.MethodPost,
+				Path:       "/collections.export_all",
+				RequestID:  "abc",
+			},
+			wantErr: "POST /collections.export_all: status 403 (authorization_error): Authorization error [request-id: abc]",
+		},
+		{
+			name: "empty-body",
+			code: http.StatusBadGateway,
+			want: APIError{
+				StatusCode: http.StatusBadGateway,
+				Method:     http.MethodPost,
+				Path:       "/collections.export_all",
+			},
+			wantErr: "POST /collections.export_all: status 502",
+		},
+		{
+			name: "html-body",
+			code: http.StatusBadGateway,
+			body: "<html>\n  <body>Bad Gateway</body>\n</html>\n",
+			want: APIError{
+				StatusCode: http.StatusBadGateway,
+				Message:    "<html> <body>Bad Gateway</body> </html>",
+				Method:     http.MethodPost,
+				Path:       "/collections.export_all",
+			},
+			wantErr: "POST /collections.export_all: status 502: <html> <body>Bad Gateway</body> </html>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := newAPIError(newTestResponse(tt.code, tt.requestID), "/collections.export_all", []byte(tt.body))
+
+			if *err != tt.want {
+				t.Errorf("newAPIError() = %+v, want %+v", *err, tt.want)
+			}
+
+			if err.Error() != tt.wantErr {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewAPIErrorTruncate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "ascii", body: strings.Repeat("x", 10*maxErrorBodyLen)},
+		{name: "multi-byte", body: "x" + strings.Repeat("é", maxErrorBodyLen)},
+		{name: "invalid-utf8", body: strings.Repeat("\xff", 10) + strings.Repeat("x", 10*maxErrorBodyLen)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := newAPIError(newTestResponse(http.StatusInternalServerError, ""), "/documents.info", []byte(tt.body))
+
+			if len(err.Message) > maxErrorBodyLen+len("...") || !strings.HasSuffix(err.Message, "...") {
+				t.Errorf("Message has %d bytes, want it truncated to %d", len(err.Message), maxErrorBodyLen)
+			}
+
+			if !utf8.ValidString(err.Message) {
+				t.Errorf("Message = %q, want valid UTF-8", err.Message)
+			}
+		})
+	}
+}
+
+func TestIsHelpers(t *testing.T) {
+	t.Parallel()
+
+	helpers := map[string]func(error) bool{
+		"IsUnauthorized": IsUnauthorized,
+		"IsForbidden":    IsForbidden,
+		"IsNotFound":     IsNotFound,
+		"IsRateLimited":  IsRateLimited,
+	}
+
+	tests := []struct {
+		code int
+		want string // Name of the helper which should match, if any.
+	}{
+		{code: http.StatusUnauthorized, want: "IsUnauthorized"},
+		{code: http.StatusForbidden, want: "IsForbidden"},
+		{code: http.StatusNotFound, want: "IsNotFound"},
+		{code: http.StatusTooManyRequests, want: "IsRateLimited"},
+		{code: http.StatusBadRequest},
+		{code: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.code), func(t *testing.T) {
+			t.Parallel()
+
+			apiErr := newAPIError(newTestResponse(tt.code, ""), "/documents.info", nil)
+			wrapped := fmt.Errorf("failed to export: %w", apiErr)
+
+			for name, fn := range helpers {
+				want := name == tt.want
+
+				if got := fn(apiErr); got != want {
+					t.Errorf("%s(%v) = %v, want %v", name, apiErr, got, want)
+				}
+
+				if got := fn(wrapped); got != want {
+					t.Errorf("%s(%v) = %v, want %v", name, wrapped, got, want)
+				}
+			}
+
+			var target *APIError
+			if !errors.As(wrapped, &target) || target != apiErr {
+				t.Errorf("errors.As() didn't find the APIError in %v", wrapped)
+			}
+
+			if !errors.Is(wrapped, apiErr) {
+				t.Errorf("errors.Is() didn't match the APIError in %v", wrapped)
+			}
+		})
+	}
+}
+
+func TestIsHelpersOtherErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, err := range []error{nil, errors.New("status 401"), fmt.Errorf("wrapped: %w", errors.New("404"))} {
+		if IsUnauthorized(err) || IsForbidden(err) || IsNotFound(err) || IsRateLimited(err) {
+			t.Errorf("helpers matched non-APIError %v", err)
+		}
+	}
+}
+
+func TestDoLargeErrorBody(t *testing.T) {
+	t.Parallel()
+
+	// Never ends, so the body must not be read entirely.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+
+		chunk := []byte(strings.Repeat("x", 1024))
+		for r.Context().Err() == nil {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(&Config{BaseURL: srv.URL, Token: "tok"})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	_, err = do(ctx, client, http.MethodPost, "/documents.info", nil, map[string]any{})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("do() error = %v, want an APIError with status %d", err, http.StatusBadRequest)
+	}
+
+	if len(apiErr.Message) != maxErrorBodyLen+len("...") {
+		t.Errorf("Message has %d bytes, want it truncated to %d", len(apiErr.Message), maxErrorBodyLen)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultUserAgent is the User-Agent sent with all requests, unless overridden
+// with [WithUserAgent].
+const DefaultUserAgent = "outline-export"
+
+// Option configures optional behavior of a [Client].
+type Option func(*options)
+
+type options struct {
+	transport  http.RoundTripper
+	middleware []Middleware
+	headers    http.Header
+	userAgent  string
+	hooks      Hooks
+}
+
+// Hooks are notified of requests and waits performed by the client (e.g. to
+// record metrics). Hooks are called synchronously, and must be safe for
+// concurrent use.
+type Hooks interface {
+	// RequestCompleted is called after each attempt of an API request (including
+	// retries), with the API endpoint (e.g. "/documents.info") and the response
+	// status code, or 0 if the request failed without a response.
+	RequestCompleted(endpoint string, status int)
+
+	// FileOperationWaited is called after waiting for a file operation (see
+	// [Client.WaitForFileOperation]), whether it completed or not.
+	FileOperationWaited(id string, d time.Duration)
+}
+
+// noopHooks are the default hooks, which do nothing.
+type noopHooks struct{}
+
+func (noopHooks) RequestCompleted(string, int)              {}
+func (noopHooks) FileOperationWaited(string, time.Duration) {}
+
+// Middleware wraps the transport used by the client, and can inspect or modify
+// requests before they're sent, and responses before they're returned (e.g. for
+// audit logging, caching, or rate limiting). Middleware is also invoked for
+// redirects (e.g. to object storage when downloading exports).
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to allow the use of ordinary functions as
+// [http.RoundTripper]s, which is useful when writing [Middleware].
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithTransport sets the base transport used for all requests. When provided,
+// the TLS and proxy settings of the [Config] are ignored, and must be configured
+// on the transport instead.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.transport = rt
+	}
+}
+
+// WithMiddleware adds middleware around the transport. Middleware is invoked in
+// the order provided, i.e. the first middleware sees the request first, and the
+// response last.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, mw...)
+	}
+}
+
+// WithHeader adds a header sent with all API requests. The Authorization,
+// Content-Type and User-Agent headers are managed by the client, and can't be
+// overridden.
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		if o.headers == nil {
+			o.headers = make(http.Header)
+		}
+		o.headers.Add(key, value)
+	}
+}
+
+// WithHooks sets the hooks notified of requests and waits performed by the
+// client.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.hooks = hooks
+	}
+}
+
+// WithUserAgent sets the User-Agent sent with all API requests, in the form of
+// "<product>/<version>" (or just "<product>" if version is empty).
+func WithUserAgent(product, version string) Option {
+	return func(o *options) {
+		o.userAgent = product
+		if version != "" {
+			o.userAgent += "/" + version
+		}
+	}
+}
@@ -8,11 +8,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"time"
+
+	"github.com/lrstanley/outline-export/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // prepareRequest prepares a request for the given client, method, path, params, and body.
@@ -38,12 +44,16 @@ func prepareRequest(
 		return nil, fmt.Errorf("failed to initialize request: %w", err)
 	}
 
+	for k, v := range client.headers {
+		req.Header[k] = slices.Clone(v)
+	}
+
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
 	req.Header.Set("Authorization", "Bearer "+client.Config.Token)
-	req.Header.Set("User-Agent", "outline-export")
+	req.Header.Set("User-Agent", client.userAgent)
 
 	if params != nil {
 		query := req.URL.Query()
@@ -56,6 +66,111 @@ func prepareRequest(
 	return req, nil
 }
 
+// do sends the request, retrying on transient failures according to the
+// client's [RetryPolicy]. If the response status indicates success, the response
+// is returned and the caller is responsible for closing the body, otherwise an
+// [APIError] is returned.
+func do(
+	ctx context.Context,
+	client *Client,
+	method,
+	path string,
+	params map[string]string,
+	body map[string]any,
+) (*http.Response, error) {
+	policy := client.Config.Retry
+	idempotent := !nonIdempotentPaths[path]
+
+	for attempt := 1; ; attempt++ {
+		req, err := prepareRequest(ctx, client, method, path, params, body)
+		if err != nil {
+			return nil, err
+		}
+
+		logger := client.Config.Logger.With(
+			"method", req.Method,
+			"url", client.redact(req.URL.String()),
+			"attempt", attempt,
+		)
+
+		logger.DebugContext(ctx, "sending request")
+		start := time.Now()
+
+		resp, err := client.HTTPClient.Do(req)
+		if err != nil {
+			client.hooks.RequestCompleted(path, 0)
+
+			// Errors include the request URL (which may be a redirect), so ensure
+			// it never includes the token.
+			var uerr *url.Error
+			if errors.As(err, &uerr) {
+				uerr.URL = client.redact(uerr.URL)
+			}
+
+			if attempt >= policy.MaxAttempts || ctx.Err() != nil || (!idempotent && !isConnectError(err)) {
+				return nil, err
+			}
+
+			delay := policy.backoff(attempt)
+			logger.WarnContext(ctx, "request failed, retrying", "error", err, "delay", delay)
+
+			if err = sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		client.hooks.RequestCompleted(path, resp.StatusCode)
+
+		logger = logger.With(
+			"status", resp.Status,
+			"duration", time.Since(start).Round(time.Millisecond),
+		)
+
+		if resp.StatusCode < 299 {
+			logger.DebugContext(ctx, "request completed")
+			return resp, nil
+		}
+
+		rbody, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyRead))
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body: %w", err)
+		}
+		rbody = []byte(client.redact(string(rbody)))
+
+		if idempotent && isRetryableStatus(resp.StatusCode) && attempt < policy.MaxAttempts {
+			delay := policy.backoff(attempt)
+
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+				if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+					if !policy.allowsRetryAfter(after) {
+						// Retrying early would only burn attempts, so give up instead.
+						logger.WarnContext(
+							ctx, "request failed, server requested a delay longer than allowed",
+							"body", string(rbody),
+							"retry_after", after,
+							"max_retry_after", policy.MaxRetryAfter,
+						)
+						return nil, newAPIError(resp, path, rbody)
+					}
+					delay = after
+				}
+			}
+
+			logger.WarnContext(ctx, "request failed, retrying", "body", string(rbody), "delay", delay)
+
+			if err = sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		logger.DebugContext(ctx, "request failed", "body", string(rbody))
+		return nil, newAPIError(resp, path, rbody)
+	}
+}
+
 // request is a generic function that makes an HTTP request to the given path, with
 // the given method, params, and body. If the type of T is a string, the body will be
 // read and returned as a string, otherwise [request] will attempt to parse the body
@@ -70,40 +185,12 @@ func request[T any](
 ) (T, error) {
 	var result T
 
-	req, err := prepareRequest(ctx, client, method, path, params, body)
-	if err != nil {
-		return result, err
-	}
-
-	logger := slog.With(
-		"method", req.Method,
-		"url", req.URL.String(),
-	)
-
-	logger.DebugContext(ctx, "sending request")
-	start := time.Now()
-	resp, err := client.HTTPClient.Do(req)
+	resp, err := do(ctx, client, method, path, params, body)
 	if err != nil {
 		return result, err
 	}
 	defer resp.Body.Close() //nolint:errcheck
 
-	logger = logger.With(
-		"status", resp.Status,
-		"duration", time.Since(start).Round(time.Millisecond),
-	)
-
-	if resp.StatusCode >= 299 {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return result, fmt.Errorf("failed to read body: %w", err)
-		}
-		logger.ErrorContext(ctx, "request failed", "body", string(body))
-
-		return result, fmt.Errorf("request failed with status code %d", resp.StatusCode)
-	}
-	logger.DebugContext(ctx, "request completed")
-
 	// Decode and wrap in generics. if type of T is string, return the body as a string.
 	if _, ok := any(result).(string); ok {
 		body, err := io.ReadAll(resp.Body)
@@ -117,6 +204,8 @@ func request[T any](
 	return result, nil
 }
 
+// requestStream is similar to [request], however it returns the response body
+// as-is, and the caller is responsible for closing it.
 func requestStream(
 	ctx context.Context,
 	client *Client,
@@ -125,35 +214,34 @@ func requestStream(
 	params map[string]string,
 	body map[string]any,
 ) (io.ReadCloser, error) {
-	req, err := prepareRequest(ctx, client, method, path, params, body)
-	if err != nil {
-		return nil, err
-	}
-
-	logger := slog.With(
-		"method", req.Method,
-		"url", req.URL.String(),
-	)
-
-	logger.DebugContext(ctx, "sending request")
-	start := time.Now()
-
-	resp, err := client.HTTPClient.Do(req)
+	resp, err := do(ctx, client, method, path, params, body)
 	if err != nil {
 		return nil, err
 	}
+	return resp.Body, nil
+}
 
-	logger = logger.With(
-		"status", resp.Status,
-		"duration", time.Since(start).Round(time.Millisecond),
-	)
+// spanReader ends the span once the underlying reader is closed, recording the
+// number of bytes read.
+type spanReader struct {
+	io.ReadCloser
+	span trace.Span
+	n    int64
+	err  error
+}
 
-	if resp.StatusCode >= 299 {
-		defer resp.Body.Close() //nolint:errcheck
-		logger.ErrorContext(ctx, "request failed")
-		return nil, fmt.Errorf("request failed with status code %d", resp.StatusCode)
+func (r *spanReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
 	}
+	return n, err
+}
 
-	logger.DebugContext(ctx, "request completed")
-	return resp.Body, nil
+func (r *spanReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.span.SetAttributes(attribute.Int64("outline.bytes", r.n))
+	tracing.End(r.span, r.err)
+	return err
 }
@@ -0,0 +1,149 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts   = 4
+	DefaultRetryBaseDelay     = 1 * time.Second
+	DefaultRetryMaxDelay      = 30 * time.Second
+	DefaultRetryJitter        = 0.2
+	DefaultRetryMaxRetryAfter = 10 * time.Minute
+)
+
+// nonIdempotentPaths are endpoints which create resources on the server side, and
+// as such, should only be retried when we know the request never reached the
+// server (e.g. a connection error), otherwise we may end up with duplicates.
+var nonIdempotentPaths = map[string]bool{
+	"/collections.export":     true,
+	"/collections.export_all": true,
+}
+
+// RetryPolicy configures how failed requests are retried. Requests are retried
+// on transport errors, 5xx responses, and 429 responses. When the server provides
+// a Retry-After header on a 429 or 503 response, it is used instead of the
+// computed backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the initial
+	// request. A value of 1 disables retries.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. Each subsequent retry
+	// doubles the delay, up to MaxDelay.
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum delay between retries (excluding delays requested
+	// by the server through Retry-After).
+	MaxDelay time.Duration
+
+	// MaxRetryAfter is the maximum delay requested by the server through
+	// Retry-After which is honored. If the server asks to wait longer, the request
+	// fails instead of being retried early. Zero disables the limit.
+	MaxRetryAfter time.Duration
+
+	// Jitter is the fraction (0-1) of the delay which is randomized, to prevent
+	// multiple clients from retrying in lockstep.
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns the default retry policy.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:   DefaultRetryMaxAttempts,
+		BaseDelay:     DefaultRetryBaseDelay,
+		MaxDelay:      DefaultRetryMaxDelay,
+		MaxRetryAfter: DefaultRetryMaxRetryAfter,
+		Jitter:        DefaultRetryJitter,
+	}
+}
+
+// backoff returns the delay to wait before the next attempt, where attempt is
+// the number of the attempt that just failed (starting at 1).
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 && delay > 0 {
+		delay -= time.Duration(rand.Float64() * min(p.Jitter, 1) * float64(delay)) //nolint:gosec
+	}
+
+	return delay
+}
+
+// allowsRetryAfter returns true if the delay requested by the server through
+// Retry-After is within MaxRetryAfter.
+func (p *RetryPolicy) allowsRetryAfter(d time.Duration) bool {
+	return p.MaxRetryAfter <= 0 || d <= p.MaxRetryAfter
+}
+
+// isRetryableStatus returns true if the status code indicates a transient
+// failure.
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// isConnectError returns true if the error indicates that the request never
+// reached the server (e.g. DNS resolution or dialing failed), which makes it
+// safe to retry non-idempotent requests.
+func isConnectError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter parses the Retry-After header, which may either be a number
+// of seconds, or an HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+
+	return 0, false
+}
+
+// sleep waits for the given duration, or until the context is canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := &RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 1 * time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 8 * time.Second},
+		{attempt: 5, want: 10 * time.Second},
+		{attempt: 100, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			t.Parallel()
+
+			if got := policy.backoff(tt.attempt); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	t.Parallel()
+
+	policy := &RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, Jitter: 0.5}
+
+	for range 100 {
+		if got := policy.backoff(3); got <= 2*time.Second || got > 4*time.Second {
+			t.Fatalf("backoff(3) = %v, want within (2s, 4s]", got)
+		}
+	}
+}
+
+func TestRetryPolicyAllowsRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		maxRetryAfter time.Duration
+		in            time.Duration
+		want          bool
+	}{
+		{name: "below-max", maxRetryAfter: time.Minute, in: 5 * time.Second, want: true},
+		{name: "at-max", maxRetryAfter: time.Minute, in: time.Minute, want: true},
+		{name: "above-max", maxRetryAfter: time.Minute, in: time.Hour, want: false},
+		{name: "no-max", in: time.Hour, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			policy := &RetryPolicy{MaxDelay: time.Millisecond, MaxRetryAfter: tt.maxRetryAfter}
+			if got := policy.allowsRetryAfter(tt.in); got != tt.want {
+				t.Errorf("allowsRetryAfter(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "empty", in: "", wantOK: false},
+		{name: "seconds", in: "120", want: 120 * time.Second, wantOK: true},
+		{name: "zero", in: "0", want: 0, wantOK: true},
+		{name: "whitespace", in: " 5 ", want: 5 * time.Second, wantOK: true},
+		{name: "negative", in: "-5", wantOK: false},
+		{name: "garbage", in: "soon", wantOK: false},
+		{name: "date-past", in: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := parseRetryAfter(tt.in)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter(%q) = (%v, %v), want (%v, %v)", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfterDate(t *testing.T) {
+	t.Parallel()
+
+	got, ok := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if !ok || got <= 58*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter() = (%v, %v), want about 1m", got, ok)
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{code: http.StatusOK, want: false},
+		{code: http.StatusBadRequest, want: false},
+		{code: http.StatusUnauthorized, want: false},
+		{code: http.StatusForbidden, want: false},
+		{code: http.StatusNotFound, want: false},
+		{code: http.StatusTooManyRequests, want: true},
+		{code: http.StatusInternalServerError, want: true},
+		{code: http.StatusBadGateway, want: true},
+		{code: http.StatusServiceUnavailable, want: true},
+		{code: http.StatusGatewayTimeout, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.code), func(t *testing.T) {
+			t.Parallel()
+
+			if got := isRetryableStatus(tt.code); got != tt.want {
+				t.Errorf("isRetryableStatus(%d) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+// newRetryTestClient returns a client (using policy) for a test server which
+// responds with status (and the optional Retry-After header) for all requests,
+// along with a counter of the requests the server received.
+func newRetryTestClient(t *testing.T, policy *RetryPolicy, status int, retryAfter string) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	var hits atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"ok":false}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewClient(&Config{
+		BaseURL: srv.URL,
+		Token:   "tok",
+		Retry:   policy,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	return client, &hits
+}
+
+func TestDoRetries(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		wantHits int32
+	}{
+		{name: "idempotent/500", path: "/documents.info", status: http.StatusInternalServerError, wantHits: 3},
+		{name: "idempotent/502", path: "/documents.info", status: http.StatusBadGateway, wantHits: 3},
+		{name: "idempotent/503", path: "/documents.info", status: http.StatusServiceUnavailable, wantHits: 3},
+		{name: "idempotent/429", path: "/documents.info", status: http.StatusTooManyRequests, wantHits: 3},
+		{name: "idempotent/400", path: "/documents.info", status: http.StatusBadRequest, wantHits: 1},
+		{name: "idempotent/401", path: "/documents.info", status: http.StatusUnauthorized, wantHits: 1},
+		{name: "idempotent/404", path: "/documents.info", status: http.StatusNotFound, wantHits: 1},
+		{name: "export/500", path: "/collections.export", status: http.StatusInternalServerError, wantHits: 1},
+		{name: "export_all/500", path: "/collections.export_all", status: http.StatusInternalServerError, wantHits: 1},
+		{name: "export_all/503", path: "/collections.export_all", status: http.StatusServiceUnavailable, wantHits: 1},
+		{name: "export_all/429", path: "/collections.export_all", status: http.StatusTooManyRequests, wantHits: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, hits := newRetryTestClient(t, &RetryPolicy{
+				MaxAttempts: 3,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    10 * time.Millisecond,
+			}, tt.status, "")
+
+			_, err := do(t.Context(), client, http.MethodPost, tt.path, nil, map[string]any{})
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("do() error = %v, want an APIError with status %d", err, tt.status)
+			}
+
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("server received %d requests, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestDoRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	// Retry-After takes precedence over MaxDelay, so the client doesn't retry
+	// before the rate limit resets.
+	client, hits := newRetryTestClient(t, &RetryPolicy{
+		MaxAttempts:   2,
+		BaseDelay:     time.Millisecond,
+		MaxDelay:      time.Millisecond,
+		MaxRetryAfter: time.Minute,
+	}, http.StatusTooManyRequests, "1")
+
+	start := time.Now()
+	_, err := do(t.Context(), client, http.MethodPost, "/documents.info", nil, map[string]any{})
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("do() retried after %v, want Retry-After (1s) to be honored", elapsed)
+	}
+
+	if !IsRateLimited(err) || hits.Load() != 2 {
+		t.Errorf("do() error = %v after %d requests, want a rate limit error after 2", err, hits.Load())
+	}
+}
+
+func TestDoRetryAfterTooLong(t *testing.T) {
+	t.Parallel()
+
+	client, hits := newRetryTestClient(t, &RetryPolicy{
+		MaxAttempts:   3,
+		BaseDelay:     time.Millisecond,
+		MaxDelay:      time.Millisecond,
+		MaxRetryAfter: time.Minute,
+	}, http.StatusTooManyRequests, "3600")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	// Retrying early would only burn attempts, so the request fails right away.
+	_, err := do(ctx, client, http.MethodPost, "/documents.info", nil, map[string]any{})
+	if ctx.Err() != nil {
+		t.Fatal("do() waited for a Retry-After beyond MaxRetryAfter")
+	}
+
+	if !IsRateLimited(err) || hits.Load() != 1 {
+		t.Errorf("do() error = %v after %d requests, want a rate limit error after 1", err, hits.Load())
+	}
+}
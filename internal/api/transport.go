@@ -0,0 +1,74 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// DefaultMinTLSVersion is the minimum TLS version used when none is configured.
+const DefaultMinTLSVersion = tls.VersionTLS12
+
+// newTransport returns the transport used for all requests (including redirects
+// to object storage), based on the TLS and proxy settings of the config.
+func newTransport(config *Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+
+	tlsConfig := &tls.Config{
+		MinVersion:         config.MinTLSVersion,
+		InsecureSkipVerify: config.InsecureSkipVerify, //nolint:gosec
+	}
+
+	if config.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		data, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in ca file %q", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (config.ClientCertFile == "") != (config.ClientKeyFile == "") {
+		return nil, errors.New("client certificate and client key must be provided together")
+	}
+
+	if config.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	if config.ProxyURL != "" {
+		proxy, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+
+		if proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5" {
+			return nil, fmt.Errorf("invalid proxy url: unsupported scheme %q", proxy.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return transport, nil
+}
@@ -35,14 +35,37 @@ const (
 type FileOperationType string
 
 type FileOperation struct {
-	ID        string              `json:"id"`
-	Name      string              `json:"name"`
-	Type      FileOperationType   `json:"type"`
-	Format    ExportFormat        `json:"format"`
-	State     FileOperationState  `json:"state"`
-	Error     *FileOperationError `json:"error"`
-	CreatedAt time.Time           `json:"createdAt"`
-	UpdatedAt time.Time           `json:"updatedAt"`
+	ID           string              `json:"id"`
+	Name         string              `json:"name"`
+	Type         FileOperationType   `json:"type"`
+	Format       ExportFormat        `json:"format"`
+	State        FileOperationState  `json:"state"`
+	Error        *FileOperationError `json:"error"`
+	CollectionID string              `json:"collectionId"` // Empty when exporting all collections.
+	User         *User               `json:"user"`         // User who created the file operation.
+	CreatedAt    time.Time           `json:"createdAt"`
+	UpdatedAt    time.Time           `json:"updatedAt"`
+}
+
+// User is an Outline user.
+type User struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	AvatarURL string `json:"avatarUrl,omitempty"`
+}
+
+// Team is an Outline team (workspace).
+type Team struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// AuthInfo contains the user and team the token belongs to.
+type AuthInfo struct {
+	User *User `json:"user"`
+	Team *Team `json:"team"`
 }
 
 type FileOperationError struct {
@@ -79,6 +102,60 @@ func (e *FileOperationError) UnmarshalJSON(data []byte) error {
 	return err
 }
 
+const (
+	CollectionPermissionRead      CollectionPermission = "read"
+	CollectionPermissionReadWrite CollectionPermission = "read_write"
+)
+
+// CollectionPermission is the default permission workspace members have on a
+// collection. Private collections have no default permission.
+type CollectionPermission string
+
+type Collection struct {
+	ID          string               `json:"id"`
+	URLID       string               `json:"urlId"`
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Permission  CollectionPermission `json:"permission"`
+	Sharing     bool                 `json:"sharing"`
+	Color       string               `json:"color"`
+	Icon        string               `json:"icon"`
+	Index       string               `json:"index"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	UpdatedAt   time.Time            `json:"updatedAt"`
+	ArchivedAt  *time.Time           `json:"archivedAt"`
+	DeletedAt   *time.Time           `json:"deletedAt"`
+}
+
+// IsPrivate returns true if the collection is private (i.e. only members which
+// were explicitly added have access).
+func (c *Collection) IsPrivate() bool {
+	return c.Permission == ""
+}
+
+type Document struct {
+	ID               string     `json:"id"`
+	URLID            string     `json:"urlId"`
+	Title            string     `json:"title"`
+	Icon             string     `json:"icon"`
+	CollectionID     string     `json:"collectionId"`
+	ParentDocumentID string     `json:"parentDocumentId"`
+	Revision         int        `json:"revision"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+	PublishedAt      *time.Time `json:"publishedAt"`
+	ArchivedAt       *time.Time `json:"archivedAt"`
+	DeletedAt        *time.Time `json:"deletedAt"`
+}
+
+// NavigationNode is a node in the document structure of a collection.
+type NavigationNode struct {
+	ID       string            `json:"id"`
+	Title    string            `json:"title"`
+	URL      string            `json:"url"`
+	Children []*NavigationNode `json:"children"`
+}
+
 type Pagination struct {
 	Limit    int    `json:"limit"`
 	Offset   int    `json:"offset"`
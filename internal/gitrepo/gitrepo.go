@@ -0,0 +1,467 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package gitrepo manages a git repository (using a pure-Go git implementation),
+// which is used to store each export as a commit.
+package gitrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+const (
+	DefaultBranch      = "main"
+	DefaultAuthorName  = "outline-export"
+	DefaultAuthorEmail = "outline-export@localhost"
+
+	// RemoteName is the name of the remote which is pushed to, when a remote URL
+	// is configured.
+	RemoteName = "outline-export"
+
+	// stagingDirName is the name of the directory (within the git directory) new
+	// exports are written to, before they replace the working tree.
+	stagingDirName = "outline-export-staging"
+)
+
+type Options struct {
+	// Path is the path to the repository (working tree). It is initialized if it
+	// does not already exist.
+	Path string
+
+	// Branch is the branch commits are made to. Defaults to [DefaultBranch].
+	Branch string
+
+	// AuthorName and AuthorEmail are used as the author (and committer) identity.
+	AuthorName  string
+	AuthorEmail string
+
+	// RemoteURL is an optional remote (local path or file:// URL) which the branch
+	// is pushed to after each commit.
+	RemoteURL string
+}
+
+// Changes contains the number of changed files in a commit.
+type Changes struct {
+	Added    int
+	Modified int
+	Deleted  int
+}
+
+// Total returns the total number of changed files.
+func (c Changes) Total() int {
+	return c.Added + c.Modified + c.Deleted
+}
+
+type Repo struct {
+	opts   *Options
+	repo   *git.Repository
+	branch plumbing.ReferenceName
+}
+
+// Open opens the repository at the configured path, initializing it if it does
+// not exist, and ensures the configured branch is checked out.
+func Open(opts *Options) (*Repo, error) {
+	if opts.Branch == "" {
+		opts.Branch = DefaultBranch
+	}
+
+	if opts.AuthorName == "" {
+		opts.AuthorName = DefaultAuthorName
+	}
+
+	if opts.AuthorEmail == "" {
+		opts.AuthorEmail = DefaultAuthorEmail
+	}
+
+	r := &Repo{
+		opts:   opts,
+		branch: plumbing.NewBranchReferenceName(opts.Branch),
+	}
+
+	var err error
+
+	r.repo, err = git.PlainOpen(opts.Path)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		if err = os.MkdirAll(opts.Path, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create repository directory %q: %w", opts.Path, err)
+		}
+
+		r.repo, err = git.PlainInitWithOptions(opts.Path, &git.PlainInitOptions{
+			InitOptions: git.InitOptions{DefaultBranch: r.branch},
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository %q: %w", opts.Path, err)
+	}
+
+	head, err := r.repo.Head()
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		// No commits yet, so just point HEAD at the branch.
+		err = r.repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, r.branch))
+		if err != nil {
+			return nil, fmt.Errorf("failed to set HEAD to %q: %w", opts.Branch, err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	case head.Name() != r.branch:
+		_, err = r.repo.Reference(r.branch, true)
+		create := errors.Is(err, plumbing.ErrReferenceNotFound)
+
+		wt, err := r.repo.Worktree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open worktree: %w", err)
+		}
+
+		err = wt.Checkout(&git.CheckoutOptions{
+			Branch: r.branch,
+			Create: create,
+			Force:  true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to checkout branch %q: %w", opts.Branch, err)
+		}
+	}
+
+	return r, nil
+}
+
+// Clean removes everything from the working tree (except for the .git directory),
+// so it can be replaced with a new export.
+func (r *Repo) Clean() error {
+	entries, err := os.ReadDir(r.opts.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read repository directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == git.GitDirName {
+			continue
+		}
+
+		if err = os.RemoveAll(filepath.Join(r.opts.Path, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove %q: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// GitDir returns the path of the git directory (usually ".git" within the
+// working tree), which can be used to store files which should never be
+// committed.
+func (r *Repo) GitDir() (string, error) {
+	storage, ok := r.repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return "", errors.New("repository is not stored on disk")
+	}
+	return storage.Filesystem().Root(), nil
+}
+
+// Staging returns an empty staging directory (within the git directory, so it's
+// never part of the working tree), which a new export can be written to before
+// it replaces the working tree through [Repo.Replace].
+func (r *Repo) Staging() (string, error) {
+	dir, err := r.GitDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, stagingDirName)
+
+	// Remove anything left behind by an interrupted export.
+	if err = os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("failed to remove staging directory %q: %w", dir, err)
+	}
+
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create staging directory %q: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// StagingCopy returns a staging directory (see [Repo.Staging]) which contains a
+// copy of the working tree (except for the .git directory), for exports which
+// only update the files which changed.
+func (r *Repo) StagingCopy() (string, error) {
+	dir, err := r.Staging()
+	if err != nil {
+		return "", err
+	}
+
+	err = filepath.WalkDir(r.opts.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(r.opts.Path, path)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		if d.IsDir() && d.Name() == git.GitDirName {
+			return filepath.SkipDir
+		}
+
+		return copyEntry(path, filepath.Join(dir, rel), d)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to copy working tree into staging directory: %w", err)
+	}
+	return dir, nil
+}
+
+// copyEntry copies a single file, directory (without its contents), or symlink
+// from src to dst. Files keep their mode and modification time.
+func copyEntry(src, dst string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case d.IsDir():
+		// Always writable by us, so its contents can be copied.
+		return os.Mkdir(dst, info.Mode().Perm()|0o700)
+	case d.Type()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case d.Type().IsRegular():
+		if err = copyFile(src, dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+	default:
+		return nil
+	}
+}
+
+// copyFile copies the contents of the regular file src to dst.
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Replace replaces the working tree (except for the .git directory) with the
+// contents of dir (see [Repo.Staging]), which is removed afterwards.
+func (r *Repo) Replace(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read staging directory: %w", err)
+	}
+
+	if err = r.Clean(); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == git.GitDirName {
+			continue
+		}
+
+		err = os.Rename(filepath.Join(dir, entry.Name()), filepath.Join(r.opts.Path, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to move %q into working tree: %w", entry.Name(), err)
+		}
+	}
+
+	if err = os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove staging directory %q: %w", dir, err)
+	}
+	return nil
+}
+
+// Prune removes all files within dir (e.g. a staging directory, see
+// [Repo.StagingCopy]) for which keep returns false, along with any empty
+// directories. The .git directory is always left as-is. keep is called with
+// paths relative to dir. The removed paths are returned.
+func Prune(dir string, keep func(path string) bool) ([]string, error) {
+	var removed, dirs []string
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case rel == ".":
+			return nil
+		case d.IsDir() && d.Name() == git.GitDirName:
+			return filepath.SkipDir
+		case d.IsDir():
+			dirs = append(dirs, path)
+			return nil
+		case keep(rel):
+			return nil
+		}
+
+		if err = os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %q: %w", rel, err)
+		}
+		removed = append(removed, rel)
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to prune %q: %w", dir, err)
+	}
+
+	// Deepest directories first, so parents are empty by the time they're
+	// checked. Removing directories which aren't empty fails, which is what we
+	// want.
+	for _, path := range slices.Backward(dirs) {
+		_ = os.Remove(path)
+	}
+	return removed, nil
+}
+
+// Commit stages all changes in the working tree (including deletions), and
+// commits them using the message returned by fn. If there are no changes, no
+// commit is made, and an empty hash is returned.
+func (r *Repo) Commit(fn func(changes Changes) string) (hash string, changes Changes, err error) {
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		return "", changes, fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	if err = wt.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return "", changes, fmt.Errorf("failed to stage changes: %w", err)
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return "", changes, fmt.Errorf("failed to get worktree status: %w", err)
+	}
+
+	for _, s := range status {
+		switch s.Staging { //nolint:exhaustive
+		case git.Added, git.Copied:
+			changes.Added++
+		case git.Modified, git.Renamed:
+			changes.Modified++
+		case git.Deleted:
+			changes.Deleted++
+		}
+	}
+
+	if changes.Total() == 0 {
+		return "", changes, nil
+	}
+
+	sig := &object.Signature{
+		Name:  r.opts.AuthorName,
+		Email: r.opts.AuthorEmail,
+		When:  time.Now(),
+	}
+
+	h, err := wt.Commit(fn(changes), &git.CommitOptions{
+		Author:    sig,
+		Committer: sig,
+	})
+	if err != nil {
+		return "", changes, fmt.Errorf("failed to commit: %w", err)
+	}
+
+	return h.String(), changes, nil
+}
+
+// Push pushes the branch to the configured remote. It is a no-op if no remote
+// URL is configured.
+func (r *Repo) Push(ctx context.Context) error {
+	if r.opts.RemoteURL == "" {
+		return nil
+	}
+
+	if err := initLocalRemote(r.opts.RemoteURL); err != nil {
+		return err
+	}
+
+	remote, err := r.repo.Remote(RemoteName)
+	if err != nil && !errors.Is(err, git.ErrRemoteNotFound) {
+		return fmt.Errorf("failed to lookup remote: %w", err)
+	}
+
+	if remote != nil && (len(remote.Config().URLs) != 1 || remote.Config().URLs[0] != r.opts.RemoteURL) {
+		// URL changed, so recreate the remote.
+		if err = r.repo.DeleteRemote(RemoteName); err != nil {
+			return fmt.Errorf("failed to update remote: %w", err)
+		}
+		remote = nil
+	}
+
+	if remote == nil {
+		_, err = r.repo.CreateRemote(&config.RemoteConfig{
+			Name: RemoteName,
+			URLs: []string{r.opts.RemoteURL},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create remote: %w", err)
+		}
+	}
+
+	err = r.repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: RemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(r.branch + ":" + r.branch)},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to push to %q: %w", r.opts.RemoteURL, err)
+	}
+	return nil
+}
+
+// initLocalRemote initializes a bare repository at the remote URL, if it's a local
+// path (or file:// URL) which does not exist yet.
+func initLocalRemote(remoteURL string) error {
+	path, ok := strings.CutPrefix(remoteURL, "file://")
+	if !ok && !filepath.IsAbs(path) && !strings.HasPrefix(path, ".") {
+		return nil
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return nil //nolint:nilerr
+	}
+
+	if _, err := git.PlainInit(path, true); err != nil {
+		return fmt.Errorf("failed to initialize remote repository %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package gitrepo
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeFiles writes the provided files (relative paths to contents) within dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("failed to create parent dirs of %q: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %q: %v", name, err)
+		}
+	}
+}
+
+// listFiles returns the slash-separated paths of all files and directories
+// within dir (excluding the .git directory), sorted.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var paths []string
+
+	err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case path == ".":
+			return nil
+		case d.IsDir() && d.Name() == ".git":
+			return fs.SkipDir
+		case d.IsDir():
+			path += "/"
+		}
+
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+
+	slices.Sort(paths)
+	return paths
+}
+
+func openTestRepo(t *testing.T) *Repo {
+	t.Helper()
+
+	repo, err := Open(&Options{Path: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return repo
+}
+
+func TestReplace(t *testing.T) {
+	t.Parallel()
+
+	repo := openTestRepo(t)
+	writeFiles(t, repo.opts.Path, map[string]string{"old/a.md": "a", "stale.md": "x"})
+
+	staging, err := repo.Staging()
+	if err != nil {
+		t.Fatalf("Staging() error = %v", err)
+	}
+
+	gitDir, err := repo.GitDir()
+	if err != nil {
+		t.Fatalf("GitDir() error = %v", err)
+	}
+
+	if filepath.Dir(staging) != gitDir {
+		t.Errorf("Staging() = %q, want a directory within %q", staging, gitDir)
+	}
+
+	writeFiles(t, staging, map[string]string{"new/b.md": "b", "c.md": "c"})
+
+	if err = repo.Replace(staging); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+
+	want := []string{"c.md", "new/", "new/b.md"}
+	if got := listFiles(t, repo.opts.Path); !slices.Equal(got, want) {
+		t.Errorf("working tree = %q, want %q", got, want)
+	}
+
+	if _, err = os.Stat(staging); !os.IsNotExist(err) {
+		t.Errorf("staging directory still exists (error = %v)", err)
+	}
+
+	// Replacing the working tree must leave the repository intact.
+	if _, _, err = repo.Commit(func(Changes) string { return "test" }); err != nil {
+		t.Errorf("Commit() error = %v", err)
+	}
+}
+
+func TestStagingRemovesLeftovers(t *testing.T) {
+	t.Parallel()
+
+	repo := openTestRepo(t)
+
+	staging, err := repo.Staging()
+	if err != nil {
+		t.Fatalf("Staging() error = %v", err)
+	}
+	writeFiles(t, staging, map[string]string{"partial.md": "x"})
+
+	staging, err = repo.Staging()
+	if err != nil {
+		t.Fatalf("Staging() error = %v", err)
+	}
+
+	if got := listFiles(t, staging); len(got) != 0 {
+		t.Errorf("Staging() left %q behind", got)
+	}
+}
+
+func TestStagingCopy(t *testing.T) {
+	t.Parallel()
+
+	repo := openTestRepo(t)
+	writeFiles(t, repo.opts.Path, map[string]string{"a/b.md": "b", "c.md": "c"})
+
+	staging, err := repo.StagingCopy()
+	if err != nil {
+		t.Fatalf("StagingCopy() error = %v", err)
+	}
+
+	want := []string{"a/", "a/b.md", "c.md"}
+	if got := listFiles(t, staging); !slices.Equal(got, want) {
+		t.Errorf("StagingCopy() = %q, want %q", got, want)
+	}
+
+	// Changes to the copy must not affect the working tree until it's replaced.
+	writeFiles(t, staging, map[string]string{"a/b.md": "changed", "d.md": "d"})
+
+	b, err := os.ReadFile(filepath.Join(repo.opts.Path, "a", "b.md"))
+	if err != nil || string(b) != "b" {
+		t.Errorf("working tree file = %q (error = %v), want it to be left as-is", b, err)
+	}
+
+	if got := listFiles(t, repo.opts.Path); !slices.Equal(got, want) {
+		t.Errorf("working tree = %q, want %q", got, want)
+	}
+
+	if err = repo.Replace(staging); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+
+	want = []string{"a/", "a/b.md", "c.md", "d.md"}
+	if got := listFiles(t, repo.opts.Path); !slices.Equal(got, want) {
+		t.Errorf("working tree = %q, want %q", got, want)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	repo := openTestRepo(t)
+	writeFiles(t, repo.opts.Path, map[string]string{
+		"keep/a.md":     "a",
+		"keep/stale.md": "x",
+		"stale/b.md":    "b",
+		"c.md":          "c",
+	})
+
+	keep := map[string]bool{
+		filepath.FromSlash("keep/a.md"): true,
+		"c.md":                          true,
+	}
+
+	removed, err := Prune(repo.opts.Path, func(path string) bool { return keep[path] })
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	slices.Sort(removed)
+	if want := []string{filepath.FromSlash("keep/stale.md"), filepath.FromSlash("stale/b.md")}; !slices.Equal(removed, want) {
+		t.Errorf("Prune() removed %q, want %q", removed, want)
+	}
+
+	want := []string{"c.md", "keep/", "keep/a.md"}
+	if got := listFiles(t, repo.opts.Path); !slices.Equal(got, want) {
+		t.Errorf("working tree = %q, want %q", got, want)
+	}
+
+	if _, err = os.Stat(filepath.Join(repo.opts.Path, ".git", "HEAD")); err != nil {
+		t.Errorf("Prune() removed the git directory: %v", err)
+	}
+}
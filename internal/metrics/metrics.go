@@ -0,0 +1,171 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package metrics contains the Prometheus metrics for each stage of an export,
+// which can either be served over HTTP (daemon mode), or written to a
+// node_exporter textfile-collector file (one-shot runs).
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "outline_export"
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Registry contains all export metrics. It intentionally doesn't include the Go
+// runtime/process collectors, so it can be written to textfiles without clashing
+// with node_exporter's own metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// Runs is the number of export runs, by job and result.
+	Runs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_total",
+		Help:      "Number of export runs, by job and result.",
+	}, []string{"job", "result"})
+
+	// RunDuration is the duration of export runs, by job.
+	RunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "run_duration_seconds",
+		Help:      "Duration of export runs, by job.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"job"})
+
+	// LastSuccess is the unix timestamp of the last successful export, by job.
+	LastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix timestamp of the last successful export, by job.",
+	}, []string{"job"})
+
+	// APIRequests is the number of Outline API requests (including retries), by
+	// endpoint and status code. Requests which failed without a response have a
+	// status of "error".
+	APIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      "Number of Outline API requests, by endpoint and status code.",
+	}, []string{"endpoint", "status"})
+
+	// BytesDownloaded is the number of bytes downloaded from exports.
+	BytesDownloaded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_downloaded_total",
+		Help:      "Number of bytes downloaded from exports.",
+	})
+
+	// FilesExtracted is the number of files written to the export path.
+	FilesExtracted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_extracted_total",
+		Help:      "Number of files written to the export path.",
+	})
+
+	// FilesSkipped is the number of files skipped, by reason.
+	FilesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "files_skipped_total",
+		Help:      "Number of files skipped during extraction, by reason.",
+	}, []string{"reason"})
+
+	// FileOperationWait is the time spent waiting for file operations to complete.
+	FileOperationWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "file_operation_wait_seconds",
+		Help:      "Time spent waiting for file operations to complete.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600},
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		Runs,
+		RunDuration,
+		LastSuccess,
+		APIRequests,
+		BytesDownloaded,
+		FilesExtracted,
+		FilesSkipped,
+		FileOperationWait,
+	)
+}
+
+// ObserveAPIRequest records a single API request. status should be 0 if the
+// request failed without a response.
+func ObserveAPIRequest(endpoint string, status int) {
+	s := "error"
+	if status > 0 {
+		s = strconv.Itoa(status)
+	}
+	APIRequests.WithLabelValues(endpoint, s).Inc()
+}
+
+// APIHooks records API requests and file operation waits of an API client (it
+// implements the api.Hooks interface).
+type APIHooks struct{}
+
+// RequestCompleted records a single API request.
+func (APIHooks) RequestCompleted(endpoint string, status int) {
+	ObserveAPIRequest(endpoint, status)
+}
+
+// FileOperationWaited records the time spent waiting for a file operation.
+func (APIHooks) FileOperationWaited(_ string, d time.Duration) {
+	FileOperationWait.Observe(d.Seconds())
+}
+
+// ObserveRun records the result of an export run. job is the name of the job
+// from the config file (if any).
+func ObserveRun(job string, start time.Time, err error) {
+	RunDuration.WithLabelValues(job).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		Runs.WithLabelValues(job, ResultFailure).Inc()
+		return
+	}
+
+	Runs.WithLabelValues(job, ResultSuccess).Inc()
+	LastSuccess.WithLabelValues(job).SetToCurrentTime()
+}
+
+// Handler returns an HTTP handler which serves the export metrics, along with
+// the Go runtime and process metrics.
+func Handler() http.Handler {
+	runtime := prometheus.NewRegistry()
+	runtime.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return promhttp.HandlerFor(prometheus.Gatherers{Registry, runtime}, promhttp.HandlerOpts{})
+}
+
+// WriteTextfile atomically writes the export metrics to path, in the format
+// expected by the node_exporter textfile collector.
+func WriteTextfile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to create metrics directory: %w", err)
+	}
+
+	if err := prometheus.WriteToTextfile(path, Registry); err != nil {
+		return fmt.Errorf("failed to write metrics textfile %q: %w", path, err)
+	}
+	return nil
+}
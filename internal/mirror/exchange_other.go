@@ -0,0 +1,12 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+//go:build !linux
+
+package mirror
+
+// exchange is not supported on this platform.
+func exchange(_, _ string) error {
+	return errExchangeUnsupported
+}
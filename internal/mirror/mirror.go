@@ -0,0 +1,89 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package mirror replaces a directory with a fully written staging directory,
+// so readers never see a partially written tree, and the directory always
+// matches exactly one export.
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stagingSuffix is appended to staging directories, which are created next to
+// the directory they replace (so they're on the same filesystem).
+const stagingSuffix = ".staging"
+
+// errExchangeUnsupported is returned by exchange when atomically exchanging two
+// paths isn't supported by the platform or filesystem.
+var errExchangeUnsupported = errors.New("atomic exchange not supported")
+
+// Stage creates a new, empty staging directory next to dst. Once written, it
+// should be moved into place with [Swap], or removed with [Discard].
+func Stage(dst string) (string, error) {
+	dst = filepath.Clean(dst)
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create parent directory of %q: %w", dst, err)
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*"+stagingSuffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory for %q: %w", dst, err)
+	}
+	return staging, nil
+}
+
+// Swap replaces dst with the staging directory, and removes the previous
+// contents of dst. Where supported (Linux), both directories are exchanged in a
+// single atomic operation, otherwise dst is briefly missing between two renames.
+func Swap(staging, dst string) error {
+	dst = filepath.Clean(dst)
+
+	info, err := os.Lstat(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		if err = os.Rename(staging, dst); err != nil {
+			return fmt.Errorf("failed to move %q into place: %w", dst, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat %q: %w", dst, err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("failed to replace %q: not a directory", dst)
+	}
+
+	// After the exchange, the staging path contains the previous contents.
+	err = exchange(staging, dst)
+	if errors.Is(err, errExchangeUnsupported) {
+		old := staging + ".old"
+
+		if err = os.Rename(dst, old); err != nil {
+			return fmt.Errorf("failed to move %q aside: %w", dst, err)
+		}
+
+		if err = os.Rename(staging, dst); err != nil {
+			_ = os.Rename(old, dst)
+			return fmt.Errorf("failed to move %q into place: %w", dst, err)
+		}
+		staging = old
+	} else if err != nil {
+		return fmt.Errorf("failed to exchange %q: %w", dst, err)
+	}
+
+	if err = os.RemoveAll(staging); err != nil {
+		return fmt.Errorf("failed to remove previous contents of %q: %w", dst, err)
+	}
+	return nil
+}
+
+// Discard removes a staging directory (see [Stage]).
+func Discard(staging string) error {
+	return os.RemoveAll(staging)
+}
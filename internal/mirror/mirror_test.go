@@ -0,0 +1,166 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package mirror
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeFiles writes the provided files (relative paths to contents) within dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatalf("failed to create parent dirs of %q: %v", name, err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %q: %v", name, err)
+		}
+	}
+}
+
+// readFiles returns the contents of all files within dir, by slash-separated
+// path.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		b, err := os.ReadFile(path)
+		files[filepath.ToSlash(rel)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to read files: %v", err)
+	}
+	return files
+}
+
+// entries returns the names of the entries within dir, sorted.
+func entries(t *testing.T, dir string) []string {
+	t.Helper()
+
+	list, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read %q: %v", dir, err)
+	}
+
+	names := make([]string, 0, len(list))
+	for _, entry := range list {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestSwap(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		existing map[string]string // Nil if dst doesn't exist yet.
+		staged   map[string]string
+	}{
+		{
+			name:   "new",
+			staged: map[string]string{"a.md": "a", "sub/b.md": "b"},
+		},
+		{
+			name:     "replace",
+			existing: map[string]string{"a.md": "old", "stale.md": "x", "stale/c.md": "c"},
+			staged:   map[string]string{"a.md": "a", "sub/b.md": "b"},
+		},
+		{
+			name:     "empty",
+			existing: map[string]string{"a.md": "a"},
+			staged:   map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			parent := t.TempDir()
+			dst := filepath.Join(parent, "export")
+
+			if tt.existing != nil {
+				writeFiles(t, dst, tt.existing)
+			}
+
+			staging, err := Stage(dst)
+			if err != nil {
+				t.Fatalf("Stage() error = %v", err)
+			}
+
+			if filepath.Dir(staging) != parent {
+				t.Errorf("Stage() = %q, want a directory next to %q", staging, dst)
+			}
+
+			writeFiles(t, staging, tt.staged)
+
+			if err = Swap(staging, dst); err != nil {
+				t.Fatalf("Swap() error = %v", err)
+			}
+
+			// Files which aren't part of the staged export (stale files) are gone.
+			if got := readFiles(t, dst); !maps.Equal(got, tt.staged) {
+				t.Errorf("Swap() left %q, want %q", got, tt.staged)
+			}
+
+			// Neither the staging directory nor the previous contents are left behind.
+			if got := entries(t, parent); !slices.Equal(got, []string{"export"}) {
+				t.Errorf("Swap() left %q behind", got)
+			}
+		})
+	}
+}
+
+func TestSwapNotDirectory(t *testing.T) {
+	t.Parallel()
+
+	parent := t.TempDir()
+	dst := filepath.Join(parent, "export")
+	writeFiles(t, parent, map[string]string{"export": "not a directory"})
+
+	staging, err := Stage(dst)
+	if err != nil {
+		t.Fatalf("Stage() error = %v", err)
+	}
+	writeFiles(t, staging, map[string]string{"a.md": "a"})
+
+	if err = Swap(staging, dst); err == nil {
+		t.Fatal("Swap() error = nil, want an error when dst isn't a directory")
+	}
+
+	if b, err := os.ReadFile(dst); err != nil || string(b) != "not a directory" {
+		t.Errorf("Swap() replaced %q (contents = %q, error = %v)", dst, b, err)
+	}
+
+	if err = Discard(staging); err != nil {
+		t.Fatalf("Discard() error = %v", err)
+	}
+
+	if got := entries(t, parent); !slices.Equal(got, []string{"export"}) {
+		t.Errorf("Discard() left %q behind", got)
+	}
+}
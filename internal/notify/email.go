@@ -0,0 +1,172 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// email sends messages over SMTP. smtp:// uses STARTTLS when the server supports
+// it, and smtps:// uses implicit TLS.
+type email struct {
+	url      *url.URL
+	host     string
+	addr     string
+	implicit bool
+	auth     smtp.Auth
+	from     *mail.Address
+	to       []*mail.Address
+}
+
+func newEmail(u *url.URL) (*email, error) {
+	e := &email{
+		url:      u,
+		host:     u.Hostname(),
+		implicit: u.Scheme == "smtps",
+	}
+
+	if e.host == "" {
+		return nil, fmt.Errorf("invalid notification url %q: missing host", redact(u))
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "587"
+		if e.implicit {
+			port = "465"
+		}
+	}
+	e.addr = net.JoinHostPort(e.host, port)
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		e.auth = smtp.PlainAuth("", u.User.Username(), password, e.host)
+	}
+
+	query := u.Query()
+
+	var err error
+	e.from, err = mail.ParseAddress(query.Get("from"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification url %q: invalid from address: %w", redact(u), err)
+	}
+
+	for _, to := range query["to"] {
+		addrs, err := mail.ParseAddressList(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification url %q: invalid to address: %w", redact(u), err)
+		}
+		e.to = append(e.to, addrs...)
+	}
+
+	if len(e.to) == 0 {
+		return nil, fmt.Errorf("invalid notification url %q: at least one to address is required", redact(u))
+	}
+
+	return e, nil
+}
+
+func (e *email) String() string {
+	return "email " + redact(e.url)
+}
+
+func (e *email) Notify(ctx context.Context, msg *Message) error {
+	var buf bytes.Buffer
+
+	recipients := make([]string, 0, len(e.to))
+	for _, to := range e.to {
+		recipients = append(recipients, to.String())
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", e.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return e.send(ctx, buf.Bytes())
+}
+
+// send sends the raw message, respecting the context deadline (if any).
+func (e *email) send(ctx context.Context, data []byte) error {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	var err error
+
+	if e.implicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: e.host}}).DialContext(ctx, "tcp", e.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", e.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Minute)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to create smtp client: %w", err)
+	}
+	defer c.Close() //nolint:errcheck
+
+	if !e.implicit {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+				return fmt.Errorf("failed to start tls: %w", err)
+			}
+		}
+	}
+
+	if e.auth != nil {
+		if err = c.Auth(e.auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err = c.Mail(e.from.Address); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+
+	for _, to := range e.to {
+		if err = c.Rcpt(to.Address); err != nil {
+			return fmt.Errorf("failed to set recipient %q: %w", to.Address, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+
+	if _, err = w.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return c.Quit()
+}
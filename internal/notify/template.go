@@ -0,0 +1,109 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate is the default notification template. Custom templates
+// (see [LoadTemplate]) can redefine the "subject" and/or "body" templates.
+const DefaultTemplate = `
+{{- define "subject" -}}
+outline-export {{ .Event }}: {{ with .Result.Job }}{{ . }} {{ end }}{{ join .Result.Formats "/" }} export
+{{- if eq .Event "failure" }} failed{{ else }} completed{{ end }}
+{{- end -}}
+
+{{- define "body" -}}
+{{- if .Error }}Error: {{ .Error }}
+{{ end -}}
+{{ with .Result.Job }}Job: {{ . }}
+{{ end -}}
+Formats: {{ join .Result.Formats ", " }}
+Mode: {{ .Result.Mode }}
+Collections: {{ if .Result.Collections }}{{ join .Result.Collections ", " }}{{ else }}all{{ end }}
+Path: {{ .Result.Path }}
+Size: {{ bytes .Result.BytesDownloaded }}
+Files: {{ .Result.FilesExtracted }} written, {{ .Result.FilesSkipped }} skipped, {{ .Result.Changes }} changed
+Duration: {{ duration .Duration }}
+{{- with .Result.FileOperations }}
+File operations: {{ join . ", " }}
+{{- end }}
+{{- with .Result.Rejected }}
+Rejected entries:
+{{- range . }}
+  - {{ .Path }} ({{ .Reason }})
+{{- end }}
+{{- end }}
+Host: {{ .Hostname }}
+{{- end -}}
+`
+
+var funcs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"bytes": func(n int64) string {
+		const unit = 1024
+		if n < unit {
+			return fmt.Sprintf("%d B", n)
+		}
+		div, exp := int64(unit), 0
+		for m := n / unit; m >= unit; m /= unit {
+			div *= unit
+			exp++
+		}
+		return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+	},
+}
+
+// Template renders notification messages.
+type Template struct {
+	tmpl *template.Template
+}
+
+// LoadTemplate parses the default template, and then the template file at path
+// (if provided), allowing it to override the "subject" and/or "body" templates.
+func LoadTemplate(path string) (*Template, error) {
+	tmpl, err := template.New("default").Funcs(funcs).Option("missingkey=error").Parse(DefaultTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse default template: %w", err)
+	}
+
+	if path != "" {
+		tmpl, err = tmpl.ParseFiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse notification template: %w", err)
+		}
+	}
+
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Render renders a message for the event. data is passed to the templates as-is.
+func (t *Template) Render(event Event, data any) (*Message, error) {
+	var subject, body bytes.Buffer
+
+	if err := t.tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render notification subject: %w", err)
+	}
+
+	if err := t.tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return nil, fmt.Errorf("failed to render notification body: %w", err)
+	}
+
+	return &Message{
+		Event:   event,
+		Subject: strings.TrimSpace(subject.String()),
+		Body:    strings.TrimSpace(body.String()) + "\n",
+		Data:    data,
+	}, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// webhook sends a generic JSON payload, containing the rendered message and the
+// data it was rendered from.
+type webhook struct {
+	url    *url.URL
+	client *http.Client
+}
+
+func (w *webhook) String() string {
+	return "webhook " + redact(w.url)
+}
+
+func (w *webhook) Notify(ctx context.Context, msg *Message) error {
+	return postJSON(ctx, w.client, w.url, map[string]any{
+		"event":   msg.Event,
+		"subject": msg.Subject,
+		"text":    msg.Body,
+		"data":    msg.Data,
+	})
+}
+
+// chat sends a message to a Slack or Mattermost-compatible incoming webhook.
+type chat struct {
+	name   string
+	url    *url.URL
+	client *http.Client
+}
+
+func (c *chat) String() string {
+	return c.name + " " + redact(c.url)
+}
+
+func (c *chat) Notify(ctx context.Context, msg *Message) error {
+	text := msg.Body
+	if msg.Subject != "" {
+		text = "*" + msg.Subject + "*\n" + msg.Body
+	}
+	return postJSON(ctx, c.client, c.url, map[string]any{"text": text})
+}
+
+// postJSON posts the payload as JSON to the provided URL, returning an error if
+// the response isn't a 2xx.
+func postJSON(ctx context.Context, client *http.Client, u *url.URL, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", redactError(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", redactError(err))
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		rbody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(rbody))
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package pathfilter matches paths (or names) against include and exclude
+// rules, using gitignore-style glob patterns (including "**" and "!" negation),
+// or regular expressions.
+package pathfilter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// RegexPrefix is the prefix of rules which are regular expressions, rather than
+// glob patterns.
+const RegexPrefix = "re:"
+
+// NegatePrefix is the prefix of rules which negate an earlier rule in the same
+// list. Use "\\!" to match a leading "!" literally.
+const NegatePrefix = "!"
+
+// rule is a single glob pattern or regular expression.
+type rule struct {
+	pattern string
+	re      *regexp.Regexp
+	dirOnly bool
+	negate  bool
+}
+
+// parseRule parses a single rule. If path is true, glob patterns follow
+// gitignore semantics:
+//
+//   - Patterns without a slash match the name of a file or directory at any
+//     depth (e.g. "*.png" is the same as "**/*.png").
+//   - Patterns with a leading or inner slash are relative to the root.
+//   - Patterns with a trailing slash only match directories.
+//
+// Rules prefixed with [NegatePrefix] are negated.
+func parseRule(pattern string, path, fold bool) (*rule, error) {
+	pattern, negate := strings.CutPrefix(pattern, NegatePrefix)
+	if strings.HasPrefix(pattern, `\`+NegatePrefix) {
+		pattern = pattern[1:]
+	}
+
+	r, err := parseExpr(pattern, path, fold)
+	if err != nil {
+		return nil, err
+	}
+
+	r.negate = negate
+	return r, nil
+}
+
+// parseExpr parses the glob pattern or regular expression of a rule (see
+// [parseRule]).
+func parseExpr(pattern string, path, fold bool) (*rule, error) {
+	if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+		if fold {
+			expr = "(?i)" + expr
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+		}
+		return &rule{re: re}, nil
+	}
+
+	if strings.Trim(pattern, "/") == "" {
+		return nil, errors.New("empty pattern")
+	}
+
+	r := &rule{pattern: pattern}
+
+	if path {
+		r.pattern, r.dirOnly = strings.CutSuffix(r.pattern, "/")
+
+		var anchored bool
+		r.pattern, anchored = strings.CutPrefix(r.pattern, "/")
+		if !anchored && !strings.Contains(r.pattern, "/") {
+			r.pattern = "**/" + r.pattern
+		}
+	}
+
+	if fold {
+		r.pattern = strings.ToLower(r.pattern)
+	}
+
+	if !doublestar.ValidatePattern(r.pattern) {
+		return nil, fmt.Errorf("invalid glob pattern %q", pattern)
+	}
+	return r, nil
+}
+
+// match reports whether the rule matches path (ignoring negation). Regular expressions match
+// directories with a trailing slash.
+func (r *rule) match(path string, dir bool) bool {
+	if r.re != nil {
+		if dir {
+			path += "/"
+		}
+		return r.re.MatchString(path)
+	}
+
+	if r.dirOnly && !dir {
+		return false
+	}
+	return doublestar.MatchUnvalidated(r.pattern, path)
+}
+
+// Filter matches paths (or names) against include and exclude rules. A nil
+// Filter matches everything.
+type Filter struct {
+	include []*rule
+	exclude []*rule
+	names   bool
+	fold    bool
+}
+
+// New returns a filter which matches slash-separated paths (relative to the
+// root, e.g. "Engineering/Welcome.md"). Rules which match a directory also
+// match everything within it.
+//
+// Like gitignore, the last rule of a list which matches a path wins, so negated
+// rules (e.g. "!drafts/keep.md") can carve exceptions out of earlier rules.
+// Unlike gitignore, a negated rule also applies to paths within a directory
+// matched by an earlier rule.
+func New(include, exclude []string) (*Filter, error) {
+	return newFilter(include, exclude, false)
+}
+
+// NewNames returns a filter which matches names (e.g. of collections) as a
+// whole, case-insensitively.
+func NewNames(include, exclude []string) (*Filter, error) {
+	return newFilter(include, exclude, true)
+}
+
+func newFilter(include, exclude []string, names bool) (*Filter, error) {
+	f := &Filter{names: names, fold: names}
+
+	for _, pattern := range include {
+		r, err := parseRule(pattern, !names, f.fold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include rule %q: %w", pattern, err)
+		}
+		f.include = append(f.include, r)
+	}
+
+	for _, pattern := range exclude {
+		r, err := parseRule(pattern, !names, f.fold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude rule %q: %w", pattern, err)
+		}
+		f.exclude = append(f.exclude, r)
+	}
+
+	return f, nil
+}
+
+// Match reports whether path (or name) is included, i.e. it matches the include
+// rules (if any are provided), and doesn't match the exclude rules. A list of
+// rules matches if the last rule which matches path isn't negated. dir should
+// be true if path is a directory.
+func (f *Filter) Match(path string, dir bool) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.fold {
+		path = strings.ToLower(path)
+	}
+
+	if len(f.include) > 0 && !f.matchAny(f.include, path, dir) {
+		return false
+	}
+	return !f.matchAny(f.exclude, path, dir)
+}
+
+// matchAny reports whether rules match path, i.e. the last rule which matches
+// path isn't negated.
+func (f *Filter) matchAny(rules []*rule, path string, dir bool) bool {
+	var matched bool
+
+	for _, r := range rules {
+		// Only rules which would change the result need to be evaluated.
+		if r.negate == matched && f.matchRule(r, path, dir) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// matchRule reports whether the rule matches path, or (when matching paths) any
+// of its parent directories.
+func (f *Filter) matchRule(r *rule, path string, dir bool) bool {
+	if r.match(path, dir) {
+		return true
+	}
+
+	if f.names {
+		return false
+	}
+
+	for p := path; ; {
+		i := strings.LastIndexByte(p, '/')
+		if i < 0 {
+			return false
+		}
+
+		p = p[:i]
+		if r.match(p, true) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package pathfilter
+
+import (
+	"strings"
+	"testing"
+)
+
+// testPath is a path matched by a filter, and whether it should be included.
+type testPath struct {
+	path string
+	dir  bool
+	want bool
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		paths   []testPath
+	}{
+		{
+			name: "no-rules",
+			paths: []testPath{
+				{path: "Engineering/Welcome.md", want: true},
+				{path: "Engineering", dir: true, want: true},
+			},
+		},
+		{
+			name:    "unanchored",
+			exclude: []string{"*.png"},
+			paths: []testPath{
+				{path: "logo.png", want: false},
+				{path: "Engineering/uploads/logo.png", want: false},
+				{path: "Engineering/Welcome.md", want: true},
+			},
+		},
+		{
+			name:    "anchored-leading-slash",
+			exclude: []string{"/Welcome.md"},
+			paths: []testPath{
+				{path: "Welcome.md", want: false},
+				{path: "Engineering/Welcome.md", want: true},
+			},
+		},
+		{
+			name:    "anchored-inner-slash",
+			include: []string{"Engineering/*.md"},
+			paths: []testPath{
+				{path: "Engineering/Welcome.md", want: true},
+				{path: "Product/Engineering/Welcome.md", want: false},
+				{path: "Product/Welcome.md", want: false},
+			},
+		},
+		{
+			name:    "double-star",
+			include: []string{"Engineering/**/*.md"},
+			paths: []testPath{
+				{path: "Engineering/Welcome.md", want: true},
+				{path: "Engineering/a/b/c/Deep.md", want: true},
+				{path: "Engineering/a/b/image.png", want: false},
+				{path: "Product/Welcome.md", want: false},
+			},
+		},
+		{
+			name:    "double-star-leading",
+			exclude: []string{"**/drafts/**"},
+			paths: []testPath{
+				{path: "drafts/a.md", want: false},
+				{path: "Engineering/drafts/a.md", want: false},
+				{path: "Engineering/a.md", want: true},
+			},
+		},
+		{
+			name:    "dir-applies-to-children",
+			include: []string{"Engineering"},
+			paths: []testPath{
+				{path: "Engineering", dir: true, want: true},
+				{path: "Engineering/Welcome.md", want: true},
+				{path: "Engineering/Sub/Page.md", want: true},
+				{path: "Product/Welcome.md", want: false},
+			},
+		},
+		{
+			name:    "dir-only",
+			exclude: []string{"uploads/"},
+			paths: []testPath{
+				{path: "Engineering/uploads", dir: true, want: false},
+				{path: "Engineering/uploads/logo.png", want: false},
+				{path: "Engineering/uploads.md", want: true},
+				{path: "uploads", want: true},
+			},
+		},
+		{
+			name:    "include-and-exclude",
+			include: []string{"Engineering/"},
+			exclude: []string{"*.png"},
+			paths: []testPath{
+				{path: "Engineering/Welcome.md", want: true},
+				{path: "Engineering/logo.png", want: false},
+				{path: "Product/Welcome.md", want: false},
+			},
+		},
+		{
+			name:    "negation-exclude",
+			exclude: []string{"drafts/", "!drafts/keep.md"},
+			paths: []testPath{
+				{path: "drafts/a.md", want: false},
+				{path: "drafts/keep.md", want: true},
+				{path: "Engineering/drafts/keep.md", want: false},
+				{path: "Welcome.md", want: true},
+			},
+		},
+		{
+			name:    "negation-include",
+			include: []string{"Engineering/**", "!*.png"},
+			paths: []testPath{
+				{path: "Engineering/Welcome.md", want: true},
+				{path: "Engineering/logo.png", want: false},
+				{path: "Product/Welcome.md", want: false},
+			},
+		},
+		{
+			name:    "negation-last-wins",
+			exclude: []string{"*.md", "!Welcome.md", "/Welcome.md"},
+			paths: []testPath{
+				{path: "Welcome.md", want: false},
+				{path: "Engineering/Welcome.md", want: true},
+				{path: "Engineering/Other.md", want: false},
+			},
+		},
+		{
+			name:    "negation-only",
+			exclude: []string{"!Welcome.md"},
+			paths: []testPath{
+				{path: "Welcome.md", want: true},
+				{path: "Other.md", want: true},
+			},
+		},
+		{
+			name:    "escaped-negation",
+			exclude: []string{`\!important.md`},
+			paths: []testPath{
+				{path: "!important.md", want: false},
+				{path: "important.md", want: true},
+			},
+		},
+		{
+			name:    "regex",
+			exclude: []string{`re:^Engineering/.*\.png$`},
+			paths: []testPath{
+				{path: "Engineering/a/logo.png", want: false},
+				{path: "Product/logo.png", want: true},
+			},
+		},
+		{
+			name:    "regex-dir",
+			exclude: []string{`re:/uploads/$`},
+			paths: []testPath{
+				{path: "Engineering/uploads", dir: true, want: false},
+				{path: "Engineering/uploads/logo.png", want: false},
+				{path: "Engineering/uploads", want: true},
+			},
+		},
+		{
+			name:    "regex-negation",
+			exclude: []string{`re:\.png$`, `!re:^keep/`},
+			paths: []testPath{
+				{path: "a/logo.png", want: false},
+				{path: "keep/logo.png", want: true},
+			},
+		},
+		{
+			name:    "case-sensitive",
+			include: []string{"engineering/"},
+			paths: []testPath{
+				{path: "Engineering/Welcome.md", want: false},
+				{path: "engineering/Welcome.md", want: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := New(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			for _, p := range tt.paths {
+				if got := f.Match(p.path, p.dir); got != p.want {
+					t.Errorf("Match(%q, %v) = %v, want %v", p.path, p.dir, got, p.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewNames(t *testing.T) {
+	t.Parallel()
+
+	f, err := NewNames([]string{"engineering*", "re:^product$", "Support/Docs"}, []string{"*archive*", "!*Archive Keep"})
+	if err != nil {
+		t.Fatalf("NewNames() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "Engineering", want: true},
+		{name: "ENGINEERING Team", want: true},
+		{name: "Engineering Archive", want: false},
+		{name: "Engineering Archive Keep", want: true},
+		{name: "Product", want: true},
+		{name: "Product Roadmap", want: false},
+		{name: "Support/Docs", want: true},
+		{name: "Docs", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := f.Match(tt.name, false); got != tt.want {
+			t.Errorf("Match(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNilFilter(t *testing.T) {
+	t.Parallel()
+
+	var f *Filter
+	if !f.Match("anything", false) {
+		t.Error("nil Filter didn't match")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    string
+	}{
+		{name: "empty", include: []string{""}, want: "include"},
+		{name: "slash", exclude: []string{"/"}, want: "exclude"},
+		{name: "negated-empty", exclude: []string{"!"}, want: "exclude"},
+		{name: "glob", include: []string{"a["}, want: "include"},
+		{name: "regex", exclude: []string{"re:("}, want: "exclude"},
+		{name: "negated-regex", include: []string{"!re:("}, want: "include"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tt.include, tt.exclude)
+			if err == nil || !strings.Contains(err.Error(), "invalid "+tt.want+" rule") {
+				t.Errorf("New() error = %v, want an invalid %s rule error", err, tt.want)
+			}
+		})
+	}
+}
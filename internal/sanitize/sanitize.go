@@ -0,0 +1,285 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package sanitize sanitizes file and folder names, using one of multiple
+// strategies, and resolves collisions between sanitized names with stable
+// suffixes.
+package sanitize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// Strict only keeps ASCII letters, digits, and a few punctuation characters.
+	Strict = "strict"
+	// Unicode keeps letters and digits in any script, and only replaces
+	// characters which filesystems reject.
+	Unicode = "unicode"
+	// WindowsSafe is like [Unicode], but also replaces characters and names which
+	// Windows rejects.
+	WindowsSafe = "windows-safe"
+	// Slug lowercases names, and replaces everything other than letters and
+	// digits (in any script) with a dash.
+	Slug = "slug"
+
+	// maxNameBytes is the maximum length of a single file or folder name, which
+	// most filesystems limit to 255 bytes.
+	maxNameBytes = 255
+)
+
+// Strategies are all supported strategies.
+var Strategies = []string{Strict, Unicode, WindowsSafe, Slug}
+
+var (
+	reInvalid     = regexp.MustCompile(`[^a-zA-Z0-9_.~\[\]()& -]+`)
+	reCleanDashes = regexp.MustCompile(`-+`)
+	reExtension   = regexp.MustCompile(`^\.[a-zA-Z0-9]{1,8}$`)
+
+	// windowsReserved are names Windows rejects, with or without an extension.
+	windowsReserved = map[string]bool{
+		"CON": true, "PRN": true, "AUX": true, "NUL": true,
+		"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+		"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+		"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+		"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	}
+)
+
+// Part sanitizes a single path part (file or folder name), using the provided
+// strategy ([Strict] if unknown). An empty string is returned if nothing is left
+// of the name (including for "." and "..").
+func Part(strategy, part string) string {
+	switch strategy {
+	case Unicode:
+		part = truncateName(sanitizeUnicodePart(part))
+	case WindowsSafe:
+		part = truncateName(sanitizeWindowsPart(part))
+	case Slug:
+		part = truncateName(sanitizeSlugPart(part))
+	default:
+		part = sanitizeStrictPart(part)
+	}
+
+	if part == "." || part == ".." {
+		return ""
+	}
+	return part
+}
+
+// sanitizeStrictPart only keeps ASCII letters, digits, and a few punctuation
+// characters.
+func sanitizeStrictPart(part string) string {
+	// Replace any potentially unsupported characters with a dash.
+	part = reInvalid.ReplaceAllString(part, "-")
+	// Clean up any double dashes.
+	part = reCleanDashes.ReplaceAllString(part, "-")
+	// Remove any leading/trailing dashes.
+	return strings.Trim(part, "-")
+}
+
+// sanitizeUnicodePart only replaces path separators and control characters.
+func sanitizeUnicodePart(part string) string {
+	part = strings.Map(func(r rune) rune {
+		if r == '/' || unicode.IsControl(r) {
+			return '-'
+		}
+		return r
+	}, strings.ToValidUTF8(part, "-"))
+
+	return strings.TrimFunc(part, func(r rune) bool {
+		return r == '-' || unicode.IsSpace(r)
+	})
+}
+
+// sanitizeWindowsPart replaces the characters Windows rejects, removes trailing
+// dots and spaces, and prefixes reserved device names (e.g. "CON") with an
+// underscore.
+func sanitizeWindowsPart(part string) string {
+	part = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || unicode.IsControl(r) {
+			return '-'
+		}
+		return r
+	}, strings.ToValidUTF8(part, "-"))
+
+	part = reCleanDashes.ReplaceAllString(part, "-")
+	part = strings.TrimRight(strings.TrimLeft(part, "- "), "-. ")
+
+	stem, _, _ := strings.Cut(part, ".")
+	if windowsReserved[strings.ToUpper(strings.TrimSpace(stem))] {
+		part = "_" + part
+	}
+	return part
+}
+
+// sanitizeSlugPart lowercases the name, and replaces everything other than
+// letters and digits with a dash. Short extensions (e.g. ".md") are kept.
+func sanitizeSlugPart(part string) string {
+	var ext string
+	if e := filepath.Ext(part); reExtension.MatchString(e) && e != part {
+		ext = strings.ToLower(e)
+		part = strings.TrimSuffix(part, e)
+	}
+
+	part = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, strings.ToValidUTF8(part, "-"))
+
+	part = strings.Trim(reCleanDashes.ReplaceAllString(part, "-"), "-")
+	if part == "" {
+		return ""
+	}
+	return part + ext
+}
+
+// truncateName truncates the name to [maxNameBytes], keeping short extensions,
+// and never splitting a multi-byte character.
+func truncateName(name string) string {
+	if len(name) <= maxNameBytes {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if !reExtension.MatchString(ext) {
+		ext = ""
+	}
+
+	stem := strings.TrimSuffix(name, ext)
+	stem = stem[:maxNameBytes-len(ext)]
+	for !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return stem + ext
+}
+
+// Resolver sanitizes file and folder names, and resolves collisions (when
+// different files or folders sanitize to the same name within a folder) by
+// adding a stable suffix, derived from the identity of the file or folder. To be
+// stable between exports, names should be resolved in a stable order.
+type Resolver struct {
+	// OnCollision is called (if set) when a collision is resolved, with the
+	// colliding and resolved paths.
+	OnCollision func(name, resolved string)
+
+	strategy string
+	fold     bool
+	names    map[string]string            // Parent + id, to the resolved name.
+	used     map[string]map[string]string // Parent, to (folded) names and their id.
+}
+
+// NewResolver returns a resolver which sanitizes names using the provided
+// strategy.
+func NewResolver(strategy string) *Resolver {
+	return &Resolver{
+		strategy: strategy,
+		// Windows (and macOS, by default) filesystems are case-insensitive.
+		fold:  strategy == WindowsSafe,
+		names: make(map[string]string),
+		used:  make(map[string]map[string]string),
+	}
+}
+
+// Resolve returns the sanitized name of raw, within the (already resolved)
+// parent path. id identifies the file or folder (e.g. the original name, or the
+// document ID). If file is true, any suffix is added before the extension. An
+// empty string is returned if nothing is left of the name once sanitized.
+func (r *Resolver) Resolve(parent, id, raw string, file bool) string {
+	key := parent + "\x00" + id
+	if name, ok := r.names[key]; ok {
+		return name
+	}
+
+	base := Part(r.strategy, raw)
+	if base == "" {
+		return ""
+	}
+
+	used := r.used[parent]
+	if used == nil {
+		used = make(map[string]string)
+		r.used[parent] = used
+	}
+
+	name := base
+	for i := 0; ; i++ {
+		folded := name
+		if r.fold {
+			folded = strings.ToLower(name)
+		}
+
+		if owner, ok := used[folded]; !ok || owner == id {
+			used[folded] = id
+			break
+		}
+
+		name = withSuffix(base, id, i, file)
+	}
+
+	if name != base && r.OnCollision != nil {
+		r.OnCollision(filepath.Join(parent, base), filepath.Join(parent, name))
+	}
+
+	r.names[key] = name
+	return name
+}
+
+// ResolvePath resolves each part of the path, using the (unsanitized) path up
+// to and including each part as its identity. Parts which are empty once
+// sanitized are dropped.
+func (r *Resolver) ResolvePath(parts []string, file bool) string {
+	var parent string
+
+	for i, part := range parts {
+		name := r.Resolve(parent, strings.Join(parts[:i+1], "/"), part, file && i == len(parts)-1)
+		if name != "" {
+			parent = filepath.Join(parent, name)
+		}
+	}
+	return parent
+}
+
+// withSuffix adds a short hash of id (and attempt, if not the first) to name,
+// before the extension if file is true. The name is shortened as needed, so the
+// suffix and extension are always kept within [maxNameBytes].
+func withSuffix(name, id string, attempt int, file bool) string {
+	if attempt > 0 {
+		id += "\x00" + strconv.Itoa(attempt)
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	suffix := "~" + hex.EncodeToString(sum[:])[:6]
+
+	var ext string
+	if file {
+		if e := filepath.Ext(name); e != name {
+			ext = e
+		}
+	}
+	stem := strings.TrimSuffix(name, ext)
+	limit := maxNameBytes - len(suffix) - len(ext)
+	if limit < 1 {
+		// Extensions this long aren't worth keeping.
+		stem, ext = name, ""
+		limit = maxNameBytes - len(suffix)
+	}
+
+	if len(stem) > limit {
+		stem = stem[:limit]
+		for !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+	}
+	return stem + suffix + ext
+}
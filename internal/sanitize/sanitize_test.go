@@ -0,0 +1,301 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package sanitize
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPart(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		strategy string
+		in       string
+		want     string
+	}{
+		{name: "strict/ascii", strategy: Strict, in: "Sub Page.md", want: "Sub Page.md"},
+		{name: "strict/unicode", strategy: Strict, in: "Überblick – Café.md", want: "berblick - Caf-.md"},
+		{name: "strict/slash", strategy: Strict, in: "a/b", want: "a-b"},
+		{name: "strict/dots", strategy: Strict, in: "..", want: ""},
+		{name: "strict/empty", strategy: Strict, in: "???", want: ""},
+		{name: "strict/unknown-strategy", strategy: "foo", in: "a:b", want: "a-b"},
+
+		{name: "unicode/keeps-letters", strategy: Unicode, in: "Überblick – Café.md", want: "Überblick – Café.md"},
+		{name: "unicode/cjk", strategy: Unicode, in: "日本語.md", want: "日本語.md"},
+		{name: "unicode/slash", strategy: Unicode, in: "a/b", want: "a-b"},
+		{name: "unicode/control", strategy: Unicode, in: "a\x00b\n", want: "a-b"},
+		{name: "unicode/colon", strategy: Unicode, in: "Q: FAQ", want: "Q: FAQ"},
+		{name: "unicode/invalid-utf8", strategy: Unicode, in: "a\xffb", want: "a-b"},
+		{name: "unicode/dots", strategy: Unicode, in: ".", want: ""},
+
+		{name: "windows/reserved-chars", strategy: WindowsSafe, in: `a<b>c:d"e\f|g?h*i`, want: "a-b-c-d-e-f-g-h-i"},
+		{name: "windows/trailing-dots", strategy: WindowsSafe, in: "name. . ", want: "name"},
+		{name: "windows/reserved-name", strategy: WindowsSafe, in: "CON", want: "_CON"},
+		{name: "windows/reserved-name-ext", strategy: WindowsSafe, in: "com1.md", want: "_com1.md"},
+		{name: "windows/not-reserved", strategy: WindowsSafe, in: "CONSOLE.md", want: "CONSOLE.md"},
+		{name: "windows/unicode", strategy: WindowsSafe, in: "Café.md", want: "Café.md"},
+
+		{name: "slug/basic", strategy: Slug, in: "Sub Page.md", want: "sub-page.md"},
+		{name: "slug/unicode", strategy: Slug, in: "Überblick – Café.md", want: "überblick-café.md"},
+		{name: "slug/no-ext", strategy: Slug, in: "Hello, World!", want: "hello-world"},
+		{name: "slug/long-ext", strategy: Slug, in: "a.verylongextension", want: "a-verylongextension"},
+		{name: "slug/only-ext", strategy: Slug, in: ".md", want: "md"},
+		{name: "slug/empty", strategy: Slug, in: "---", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Part(tt.strategy, tt.in); got != tt.want {
+				t.Errorf("Part(%q, %q) = %q, want %q", tt.strategy, tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartTruncate(t *testing.T) {
+	t.Parallel()
+
+	for _, strategy := range []string{Unicode, WindowsSafe, Slug} {
+		t.Run(strategy, func(t *testing.T) {
+			t.Parallel()
+
+			got := Part(strategy, strings.Repeat("é", 200)+".md")
+			if len(got) > maxNameBytes {
+				t.Errorf("Part() returned %d bytes, want at most %d", len(got), maxNameBytes)
+			}
+
+			if !strings.HasSuffix(got, ".md") {
+				t.Errorf("Part() = %q, want the extension to be kept", got)
+			}
+
+			if strings.ContainsRune(got, '�') || !strings.HasPrefix(got, "é") {
+				t.Errorf("Part() = %q, split a multi-byte character", got)
+			}
+		})
+	}
+}
+
+// resolveAll resolves the provided (parent, id, raw) entries in order, returning
+// the resolved names.
+func resolveAll(strategy string, entries [][3]string, file bool) []string {
+	r := NewResolver(strategy)
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = r.Resolve(e[0], e[1], e[2], file)
+	}
+	return names
+}
+
+func TestResolver(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		strategy string
+		file     bool
+		entries  [][3]string // parent, id, raw.
+		want     []string
+	}{
+		{
+			name:     "no-collision",
+			strategy: Strict,
+			file:     true,
+			entries:  [][3]string{{"", "1", "a.md"}, {"", "2", "b.md"}},
+			want:     []string{"a.md", "b.md"},
+		},
+		{
+			name:     "collision-file",
+			strategy: Strict,
+			file:     true,
+			entries:  [][3]string{{"", "1", "Welcome.md"}, {"", "2", "-Welcome.md"}},
+			want:     []string{"Welcome.md", "Welcome~d4735e.md"},
+		},
+		{
+			name:     "collision-dir",
+			strategy: Strict,
+			entries:  [][3]string{{"", "1", "Docs"}, {"", "2", "Docs?"}},
+			want:     []string{"Docs", "Docs~d4735e"},
+		},
+		{
+			name:     "same-id",
+			strategy: Strict,
+			file:     true,
+			entries:  [][3]string{{"", "1", "a.md"}, {"", "1", "a.md"}},
+			want:     []string{"a.md", "a.md"},
+		},
+		{
+			name:     "different-parents",
+			strategy: Strict,
+			file:     true,
+			entries:  [][3]string{{"a", "1", "x.md"}, {"b", "2", "x.md"}},
+			want:     []string{"x.md", "x.md"},
+		},
+		{
+			name:     "case-sensitive",
+			strategy: Unicode,
+			file:     true,
+			entries:  [][3]string{{"", "1", "Readme.md"}, {"", "2", "README.md"}},
+			want:     []string{"Readme.md", "README.md"},
+		},
+		{
+			name:     "case-insensitive",
+			strategy: WindowsSafe,
+			file:     true,
+			entries:  [][3]string{{"", "1", "Readme.md"}, {"", "2", "README.md"}, {"", "3", "readme.md"}},
+			want:     []string{"Readme.md", "README~d4735e.md", "readme~4e0740.md"},
+		},
+		{
+			name:     "slug",
+			strategy: Slug,
+			file:     true,
+			entries:  [][3]string{{"", "1", "Hello World.md"}, {"", "2", "hello-world.md"}},
+			want:     []string{"hello-world.md", "hello-world~d4735e.md"},
+		},
+		{
+			name:     "empty",
+			strategy: Strict,
+			file:     true,
+			entries:  [][3]string{{"", "1", "???"}},
+			want:     []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := resolveAll(tt.strategy, tt.entries, tt.file)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("Resolve(%q) = %q, want %q", tt.entries[i], got[i], tt.want[i])
+				}
+			}
+
+			// Suffixes are derived from the IDs, so resolving the same entries again
+			// must produce the same names.
+			for i, name := range resolveAll(tt.strategy, tt.entries, tt.file) {
+				if name != got[i] {
+					t.Errorf("Resolve(%q) is not stable: %q != %q", tt.entries[i], name, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResolverSuffixCollision(t *testing.T) {
+	t.Parallel()
+
+	r := NewResolver(Strict)
+
+	// Take the name the suffixed name of id "2" would get, so a second attempt
+	// is needed.
+	first := r.Resolve("", "0", "a~d4735e.md", true)
+	plain := r.Resolve("", "1", "a.md", true)
+	second := r.Resolve("", "2", "a.md", true)
+
+	if first != "a~d4735e.md" || plain != "a.md" {
+		t.Fatalf("unexpected names %q, %q", first, plain)
+	}
+
+	if second == first || second == plain || !strings.HasPrefix(second, "a~") || !strings.HasSuffix(second, ".md") {
+		t.Errorf("Resolve() = %q, want a unique suffixed name", second)
+	}
+}
+
+func TestResolverOnCollision(t *testing.T) {
+	t.Parallel()
+
+	r := NewResolver(Strict)
+
+	var collisions []string
+	r.OnCollision = func(name, resolved string) {
+		collisions = append(collisions, name+" -> "+resolved)
+	}
+
+	r.Resolve("dir", "1", "a.md", true)
+	r.Resolve("dir", "2", "-a.md", true)
+
+	if len(collisions) != 1 || collisions[0] != "dir/a.md -> dir/a~d4735e.md" {
+		t.Errorf("OnCollision called with %q", collisions)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	t.Parallel()
+
+	r := NewResolver(Strict)
+
+	tests := []struct {
+		parts []string
+		file  bool
+		want  string
+	}{
+		{parts: []string{"Engineering", "Welcome.md"}, file: true, want: "Engineering/Welcome.md"},
+		{parts: []string{"Engineering", "-Welcome.md"}, file: true, want: "Engineering/Welcome~083a78.md"},
+		{parts: []string{"Engineering", "Sub Page", ""}, want: "Engineering/Sub Page"},
+		{parts: []string{"", "..", "x.md"}, file: true, want: "x.md"},
+	}
+
+	for _, tt := range tests {
+		if got := r.ResolvePath(tt.parts, tt.file); got != tt.want {
+			t.Errorf("ResolvePath(%q) = %q, want %q", tt.parts, got, tt.want)
+		}
+	}
+}
+
+func TestResolverLongNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		strategy string
+		file     bool
+		raw      [2]string
+		ext      string
+	}{
+		{name: "unicode/dir", strategy: Unicode, raw: [2]string{strings.Repeat("a", 300), strings.Repeat("a", 300) + "/"}},
+		{name: "unicode/file", strategy: Unicode, file: true, raw: [2]string{strings.Repeat("a", 300) + ".md", strings.Repeat("a", 300) + "/.md"}, ext: ".md"},
+		{name: "unicode/multi-byte", strategy: Unicode, file: true, raw: [2]string{strings.Repeat("é", 150) + ".md", strings.Repeat("é", 150) + "/.md"}, ext: ".md"},
+		{name: "windows/dir", strategy: WindowsSafe, raw: [2]string{strings.Repeat("a", 300), strings.Repeat("A", 300)}},
+		{name: "windows/file", strategy: WindowsSafe, file: true, raw: [2]string{strings.Repeat("a", 300) + ".md", strings.Repeat("A", 300) + ".md"}, ext: ".md"},
+		{name: "slug/dir", strategy: Slug, raw: [2]string{strings.Repeat("a", 300), strings.Repeat("A", 300)}},
+		{name: "slug/file", strategy: Slug, file: true, raw: [2]string{strings.Repeat("a", 300) + ".md", strings.Repeat("A", 300) + ".md"}, ext: ".md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := NewResolver(tt.strategy)
+			first := r.Resolve("", "1", tt.raw[0], tt.file)
+			second := r.Resolve("", "2", tt.raw[1], tt.file)
+
+			if first == second {
+				t.Fatalf("Resolve() returned %q for both names", first)
+			}
+
+			for _, name := range []string{first, second} {
+				if len(name) > maxNameBytes {
+					t.Errorf("Resolve() returned %d bytes, want at most %d", len(name), maxNameBytes)
+				}
+
+				if !utf8.ValidString(name) || !strings.HasSuffix(name, tt.ext) {
+					t.Errorf("Resolve() = %q, want valid UTF-8 ending in %q", name, tt.ext)
+				}
+			}
+
+			if !strings.HasSuffix(second, "~d4735e"+tt.ext) {
+				t.Errorf("Resolve() = %q, want the suffix to be kept", second)
+			}
+		})
+	}
+}
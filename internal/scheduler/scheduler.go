@@ -0,0 +1,227 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package scheduler runs a function on a cron schedule or fixed interval,
+// ensuring only a single run is in progress at any given time, and keeping
+// a history of recent runs.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// DefaultHistory is the default number of runs kept in memory.
+const DefaultHistory = 10
+
+// Parse parses a schedule, which is either a standard cron expression (e.g.
+// "0 3 * * *"), a descriptor (e.g. "@daily", "@every 6h"), or an interval (e.g.
+// "6h").
+func Parse(spec string) (cron.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval must be at least 1s", spec)
+		}
+		return cron.Every(d), nil
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// Run is a single invocation of the scheduled function.
+type Run[T any] struct {
+	ID         int       `json:"id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Result     T         `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Duration returns the duration of the run (or how long it has been running,
+// if it hasn't finished yet).
+func (r *Run[T]) Duration() time.Duration {
+	if r.FinishedAt.IsZero() {
+		return time.Since(r.StartedAt)
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Succeeded returns true if the run has finished without an error.
+func (r *Run[T]) Succeeded() bool {
+	return !r.FinishedAt.IsZero() && r.Error == ""
+}
+
+type Options struct {
+	// Schedule is when runs should be started. See [Parse].
+	Schedule cron.Schedule
+
+	// Jitter is the maximum random delay added to each scheduled run.
+	Jitter time.Duration
+
+	// History is the number of runs kept in memory. Defaults to [DefaultHistory].
+	History int
+
+	// RunOnStart starts a run immediately, rather than waiting for the first
+	// scheduled time.
+	RunOnStart bool
+
+	// Logger is used for logging. Defaults to [slog.Default].
+	Logger *slog.Logger
+}
+
+// Scheduler runs a function based on a schedule.
+type Scheduler[T any] struct {
+	opts    *Options
+	fn      func(ctx context.Context) (T, error)
+	running atomic.Bool
+
+	mu          sync.RWMutex
+	startedAt   time.Time
+	lastID      int
+	lastSuccess time.Time
+	history     []*Run[T]
+}
+
+// New creates a new scheduler, which invokes fn based on the provided options.
+func New[T any](opts *Options, fn func(ctx context.Context) (T, error)) *Scheduler[T] {
+	if opts.History < 1 {
+		opts.History = DefaultHistory
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	return &Scheduler[T]{opts: opts, fn: fn}
+}
+
+// Start runs the scheduler until the context is canceled. Once canceled, the
+// context of any in-progress run is canceled as well, and Start waits for it
+// to return.
+func (s *Scheduler[T]) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.startedAt = time.Now()
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	if s.opts.RunOnStart {
+		wg.Go(func() { s.TryRun(ctx) })
+	}
+
+	for {
+		next := s.opts.Schedule.Next(time.Now())
+		if s.opts.Jitter > 0 {
+			next = next.Add(rand.N(s.opts.Jitter)) //nolint:gosec
+		}
+
+		s.opts.Logger.InfoContext(ctx, "next run scheduled", "at", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.opts.Logger.InfoContext(ctx, "scheduler stopping")
+			return
+		case <-timer.C:
+		}
+
+		wg.Go(func() { s.TryRun(ctx) })
+	}
+}
+
+// TryRun starts a run and waits for it to complete, unless a run is already in
+// progress, in which case it returns false without running.
+func (s *Scheduler[T]) TryRun(ctx context.Context) bool {
+	if !s.running.CompareAndSwap(false, true) {
+		s.opts.Logger.WarnContext(ctx, "skipping run, previous run is still in progress")
+		return false
+	}
+	defer s.running.Store(false)
+
+	s.mu.Lock()
+	s.lastID++
+	run := &Run[T]{ID: s.lastID, StartedAt: time.Now()}
+	s.history = append(s.history, run)
+	if len(s.history) > s.opts.History {
+		s.history = s.history[len(s.history)-s.opts.History:]
+	}
+	s.mu.Unlock()
+
+	logger := s.opts.Logger.With("run", run.ID)
+	logger.InfoContext(ctx, "run started")
+
+	result, err := s.fn(ctx)
+
+	s.mu.Lock()
+	run.FinishedAt = time.Now()
+	run.Result = result
+	if err != nil {
+		run.Error = err.Error()
+	} else {
+		s.lastSuccess = run.FinishedAt
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		logger.ErrorContext(ctx, "run failed", "error", err, "duration", run.Duration().Round(time.Millisecond))
+	} else {
+		logger.InfoContext(ctx, "run completed", "duration", run.Duration().Round(time.Millisecond))
+	}
+	return true
+}
+
+// Running returns true if a run is currently in progress.
+func (s *Scheduler[T]) Running() bool {
+	return s.running.Load()
+}
+
+// StartedAt returns when the scheduler was started.
+func (s *Scheduler[T]) StartedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.startedAt
+}
+
+// LastSuccess returns when the last successful run finished, or a zero time if
+// no run has succeeded yet.
+func (s *Scheduler[T]) LastSuccess() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastSuccess
+}
+
+// Interval returns the approximate interval between runs, based on the next two
+// scheduled times.
+func (s *Scheduler[T]) Interval() time.Duration {
+	next := s.opts.Schedule.Next(time.Now())
+	return s.opts.Schedule.Next(next).Sub(next)
+}
+
+// History returns copies of the most recent runs, newest first.
+func (s *Scheduler[T]) History() []Run[T] {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := make([]Run[T], 0, len(s.history))
+	for i := len(s.history) - 1; i >= 0; i-- {
+		runs = append(runs, *s.history[i])
+	}
+	return runs
+}
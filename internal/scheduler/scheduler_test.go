@@ -0,0 +1,186 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec    string
+		want    time.Time // Next run after from.
+		wantErr bool
+	}{
+		{spec: "6h", want: from.Add(6 * time.Hour)},
+		{spec: " 90s ", want: from.Add(90 * time.Second)},
+		{spec: "0 3 * * *", want: time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 1h", want: from.Add(time.Hour)},
+		{spec: "500ms", wantErr: true},
+		{spec: "0s", wantErr: true},
+		{spec: "* * *", wantErr: true},
+		{spec: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			t.Parallel()
+
+			schedule, err := Parse(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse(%q) = %v, want an error", tt.spec, schedule)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.spec, err)
+			}
+
+			if got := schedule.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Parse(%q).Next(%v) = %v, want %v", tt.spec, from, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestScheduler returns a scheduler (which is never scheduled on its own)
+// which runs fn.
+func newTestScheduler(history int, fn func(ctx context.Context) (int, error)) *Scheduler[int] {
+	return New(&Options{
+		Schedule: cron.Every(time.Hour),
+		History:  history,
+		Logger:   slog.New(slog.DiscardHandler),
+	}, fn)
+}
+
+func TestTryRunOverlap(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s := newTestScheduler(0, func(context.Context) (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+
+	done := make(chan bool)
+	go func() { done <- s.TryRun(t.Context()) }()
+
+	<-started
+	if !s.Running() {
+		t.Error("Running() = false while a run is in progress")
+	}
+
+	if s.TryRun(t.Context()) {
+		t.Error("TryRun() = true while a run is in progress, want the run to be skipped")
+	}
+
+	close(release)
+	if !<-done {
+		t.Error("TryRun() = false for the first run")
+	}
+
+	if s.Running() {
+		t.Error("Running() = true after the run completed")
+	}
+
+	history := s.History()
+	if len(history) != 1 || !history[0].Succeeded() || history[0].Result != 1 {
+		t.Errorf("History() = %+v, want a single successful run", history)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	errFailed := errors.New("failed")
+
+	var calls int
+	s := newTestScheduler(2, func(context.Context) (int, error) {
+		calls++
+		if calls == 3 {
+			return calls, errFailed
+		}
+		return calls, nil
+	})
+
+	for range 3 {
+		if !s.TryRun(t.Context()) {
+			t.Fatal("TryRun() = false, want the run to start")
+		}
+	}
+
+	history := s.History()
+	if len(history) != 2 {
+		t.Fatalf("History() returned %d runs, want 2", len(history))
+	}
+
+	// Newest first.
+	if history[0].ID != 3 || history[0].Succeeded() || history[0].Error != errFailed.Error() {
+		t.Errorf("History()[0] = %+v, want failed run 3", history[0])
+	}
+
+	if history[1].ID != 2 || !history[1].Succeeded() || history[1].Result != 2 {
+		t.Errorf("History()[1] = %+v, want successful run 2", history[1])
+	}
+
+	if last := s.LastSuccess(); !last.Equal(history[1].FinishedAt) {
+		t.Errorf("LastSuccess() = %v, want %v", last, history[1].FinishedAt)
+	}
+}
+
+func TestStartCancelsRun(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+
+	s := New(&Options{
+		Schedule:   cron.Every(time.Hour),
+		RunOnStart: true,
+		Logger:     slog.New(slog.DiscardHandler),
+	}, func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+
+	done := make(chan struct{})
+	go func() {
+		s.Start(ctx)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() didn't return after the context was canceled")
+	}
+
+	// Start waits for the in-progress run to return.
+	history := s.History()
+	if len(history) != 1 || history[0].FinishedAt.IsZero() || history[0].Error != context.Canceled.Error() {
+		t.Errorf("History() = %+v, want a single canceled run", history)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package snapshot manages timestamped export snapshots within a directory,
+// including pruning old snapshots using grandfather-father-son retention rules.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// TimeFormat is the format of the timestamp prefix of snapshot names. It
+	// sorts lexicographically, and is safe to use in file names. Milliseconds are
+	// included, so snapshots taken in quick succession don't share a name.
+	TimeFormat = "20060102T150405.000Z"
+
+	// parseFormat is used to parse the timestamp prefix of snapshot names, which
+	// also accepts the names of snapshots taken before milliseconds were included
+	// (as fractional seconds are optional when parsing).
+	parseFormat = "20060102T150405Z"
+
+	// LatestName is the name of the symlink which points to the newest snapshot.
+	LatestName = "latest"
+
+	// partialSuffix is appended to snapshots which are still being written.
+	partialSuffix = ".partial"
+)
+
+var reSnapshot = regexp.MustCompile(`^(\d{8}T\d{6}(?:\.\d{3})?Z)-([a-z0-9-]+)(\.zip)?$`)
+
+type Snapshot struct {
+	Name   string
+	Path   string
+	Format string
+	Time   time.Time
+}
+
+// Name returns the name of a snapshot taken at the given time. If archive is
+// true, the name has a .zip extension.
+func Name(t time.Time, format string, archive bool) string {
+	name := t.UTC().Format(TimeFormat) + "-" + format
+	if archive {
+		name += ".zip"
+	}
+	return name
+}
+
+// PartialPath returns the path a snapshot should be written to, before it is
+// completed with [Complete]. Partial snapshots are ignored by [List].
+func PartialPath(root, name string) string {
+	return filepath.Join(root, "."+name+partialSuffix)
+}
+
+// Complete moves a partial snapshot (see [PartialPath]) into place, and points
+// the latest symlink at it. If a snapshot with the same name already exists, an
+// error wrapping [os.ErrExist] is returned, rather than replacing it.
+func Complete(root, name string) (*Snapshot, error) {
+	dst := filepath.Join(root, name)
+
+	if _, err := os.Lstat(dst); err == nil {
+		return nil, fmt.Errorf("failed to complete snapshot %q: %w", name, os.ErrExist)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to complete snapshot %q: %w", name, err)
+	}
+
+	if err := os.Rename(PartialPath(root, name), dst); err != nil {
+		return nil, fmt.Errorf("failed to complete snapshot %q: %w", name, err)
+	}
+
+	if err := updateLatest(root, name); err != nil {
+		return nil, err
+	}
+
+	return parse(root, name), nil
+}
+
+// Discard removes a partial snapshot (see [PartialPath]).
+func Discard(root, name string) error {
+	return os.RemoveAll(PartialPath(root, name))
+}
+
+// updateLatest atomically points the latest symlink at the given snapshot.
+func updateLatest(root, name string) error {
+	tmp := filepath.Join(root, "."+LatestName+".tmp")
+	_ = os.Remove(tmp)
+
+	if err := os.Symlink(name, tmp); err != nil {
+		return fmt.Errorf("failed to create %q symlink: %w", LatestName, err)
+	}
+
+	if err := os.Rename(tmp, filepath.Join(root, LatestName)); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to update %q symlink: %w", LatestName, err)
+	}
+	return nil
+}
+
+func parse(root, name string) *Snapshot {
+	m := reSnapshot.FindStringSubmatch(name)
+	if m == nil {
+		return nil
+	}
+
+	t, err := time.Parse(parseFormat, m[1])
+	if err != nil {
+		return nil
+	}
+
+	return &Snapshot{
+		Name:   name,
+		Path:   filepath.Join(root, name),
+		Format: m[2],
+		Time:   t,
+	}
+}
+
+// List returns all completed snapshots within root, newest first.
+func List(root string) ([]*Snapshot, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		if s := parse(root, entry.Name()); s != nil {
+			snapshots = append(snapshots, s)
+		}
+	}
+
+	slices.SortFunc(snapshots, func(a, b *Snapshot) int {
+		return b.Time.Compare(a.Time)
+	})
+	return snapshots, nil
+}
+
+// Retention configures which snapshots are kept. A snapshot is kept if any of
+// the rules select it. If no rules are configured, all snapshots are kept.
+type Retention struct {
+	// KeepLast keeps the N most recent snapshots.
+	KeepLast int
+	// KeepDaily keeps the most recent snapshot of each of the last N days (which
+	// have snapshots).
+	KeepDaily int
+	// KeepWeekly keeps the most recent snapshot of each of the last N ISO weeks
+	// (which have snapshots).
+	KeepWeekly int
+	// KeepMonthly keeps the most recent snapshot of each of the last N months
+	// (which have snapshots).
+	KeepMonthly int
+}
+
+// Enabled returns true if any retention rules are configured.
+func (r Retention) Enabled() bool {
+	return r.KeepLast > 0 || r.KeepDaily > 0 || r.KeepWeekly > 0 || r.KeepMonthly > 0
+}
+
+// Select splits the snapshots (which must be sorted newest first, see [List])
+// into the ones which should be kept, and the ones which should be pruned.
+func (r Retention) Select(snapshots []*Snapshot) (keep, prune []*Snapshot) {
+	if !r.Enabled() {
+		return snapshots, nil
+	}
+
+	kept := make(map[string]bool, len(snapshots))
+
+	for i, s := range snapshots {
+		if i < r.KeepLast {
+			kept[s.Name] = true
+		}
+	}
+
+	bucket := func(n int, key func(t time.Time) string) {
+		seen := make(map[string]bool, n)
+		for _, s := range snapshots {
+			if len(seen) >= n {
+				return
+			}
+
+			k := key(s.Time)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			kept[s.Name] = true
+		}
+	}
+
+	bucket(r.KeepDaily, func(t time.Time) string { return t.Format(time.DateOnly) })
+	bucket(r.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return strconv.Itoa(year) + "-" + strconv.Itoa(week)
+	})
+	bucket(r.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") })
+
+	for _, s := range snapshots {
+		if kept[s.Name] {
+			keep = append(keep, s)
+		} else {
+			prune = append(prune, s)
+		}
+	}
+	return keep, prune
+}
+
+// Prune removes all snapshots within root which aren't selected by the retention
+// rules, returning the snapshots which were removed. Retention rules are applied
+// to each format separately.
+func Prune(root string, retention Retention) ([]*Snapshot, error) {
+	snapshots, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := make(map[string][]*Snapshot)
+	for _, s := range snapshots {
+		formats[s.Format] = append(formats[s.Format], s)
+	}
+
+	var prune []*Snapshot
+	for _, fsnapshots := range formats {
+		_, p := retention.Select(fsnapshots)
+		prune = append(prune, p...)
+	}
+
+	var removed []*Snapshot
+	for _, s := range prune {
+		if err = os.RemoveAll(s.Path); err != nil {
+			return removed, fmt.Errorf("failed to remove snapshot %q: %w", s.Name, err)
+		}
+		removed = append(removed, s)
+	}
+	return removed, nil
+}
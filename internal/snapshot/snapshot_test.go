@@ -0,0 +1,185 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestName(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2026, 10, 18, 7, 1, 59, 123456789, time.UTC)
+
+	tests := []struct {
+		format  string
+		archive bool
+		want    string
+	}{
+		{format: "markdown", want: "20261018T070159.123Z-markdown"},
+		{format: "markdown", archive: true, want: "20261018T070159.123Z-markdown.zip"},
+		{format: "markdown-json", want: "20261018T070159.123Z-markdown-json"},
+	}
+
+	for _, tt := range tests {
+		if got := Name(ts, tt.format, tt.archive); got != tt.want {
+			t.Errorf("Name(%v, %q, %v) = %q, want %q", ts, tt.format, tt.archive, got, tt.want)
+		}
+	}
+
+	if a, b := Name(ts, "json", false), Name(ts.Add(time.Millisecond), "json", false); a == b {
+		t.Errorf("Name() = %q for snapshots taken 1ms apart", a)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		wantFormat string
+		wantTime   time.Time
+		wantNil    bool
+	}{
+		{
+			name:       "20261018T070159.123Z-markdown",
+			wantFormat: "markdown",
+			wantTime:   time.Date(2026, 10, 18, 7, 1, 59, 123000000, time.UTC),
+		},
+		{
+			name:       "20261018T070159.123Z-json.zip",
+			wantFormat: "json",
+			wantTime:   time.Date(2026, 10, 18, 7, 1, 59, 123000000, time.UTC),
+		},
+		{
+			// Snapshots taken before milliseconds were included.
+			name:       "20261018T070159Z-markdown",
+			wantFormat: "markdown",
+			wantTime:   time.Date(2026, 10, 18, 7, 1, 59, 0, time.UTC),
+		},
+		{name: ".20261018T070159.123Z-markdown.partial", wantNil: true},
+		{name: "20261018T070159.12Z-markdown", wantNil: true},
+		{name: LatestName, wantNil: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := parse("root", tt.name)
+			if tt.wantNil {
+				if s != nil {
+					t.Errorf("parse(%q) = %+v, want nil", tt.name, s)
+				}
+				return
+			}
+
+			if s == nil {
+				t.Fatalf("parse(%q) = nil", tt.name)
+			}
+
+			if s.Format != tt.wantFormat || !s.Time.Equal(tt.wantTime) {
+				t.Errorf("parse(%q) = {format: %q, time: %v}, want {format: %q, time: %v}",
+					tt.name, s.Format, s.Time, tt.wantFormat, tt.wantTime)
+			}
+		})
+	}
+}
+
+// writePartial writes a partial snapshot (a single file) within root.
+func writePartial(t *testing.T, root, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(PartialPath(root, name), []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write partial snapshot: %v", err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	name := Name(time.Now(), "json", true)
+
+	writePartial(t, root, name, "first")
+
+	s, err := Complete(root, name)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	if s.Path != filepath.Join(root, name) {
+		t.Errorf("Complete() path = %q, want %q", s.Path, filepath.Join(root, name))
+	}
+
+	if target, err := os.Readlink(filepath.Join(root, LatestName)); err != nil || target != name {
+		t.Errorf("latest symlink = %q (error = %v), want %q", target, err, name)
+	}
+
+	if _, err = os.Stat(PartialPath(root, name)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial snapshot still exists (error = %v)", err)
+	}
+}
+
+func TestCompleteExisting(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	name := Name(time.Now(), "json", true)
+
+	writePartial(t, root, name, "first")
+	if _, err := Complete(root, name); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	writePartial(t, root, name, "second")
+	if _, err := Complete(root, name); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("Complete() error = %v, want %v", err, os.ErrExist)
+	}
+
+	b, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil || string(b) != "first" {
+		t.Errorf("existing snapshot = %q (error = %v), want it to be left as-is", b, err)
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+
+	names := []string{
+		"20261017T070159Z-markdown",
+		"20261018T070159.500Z-markdown",
+		"20261018T070159.100Z-markdown",
+		".20261019T000000.000Z-markdown.partial",
+		"unrelated",
+	}
+	for _, name := range names {
+		if err := os.Mkdir(filepath.Join(root, name), 0o700); err != nil {
+			t.Fatalf("failed to create %q: %v", name, err)
+		}
+	}
+
+	snapshots, err := List(root)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	want := []string{names[1], names[2], names[0]}
+	if len(snapshots) != len(want) {
+		t.Fatalf("List() returned %d snapshots, want %d", len(snapshots), len(want))
+	}
+
+	for i, s := range snapshots {
+		if s.Name != want[i] {
+			t.Errorf("List()[%d] = %q, want %q", i, s.Name, want[i])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package tracing configures optional OpenTelemetry tracing. The exporter is
+// configured using the standard OTEL_* environment variables (e.g.
+// OTEL_EXPORTER_OTLP_ENDPOINT), and tracing is disabled unless an exporter is
+// configured.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/contrib/exporters/autoexport"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the instrumentation name used for all spans.
+const Name = "github.com/lrstanley/outline-export"
+
+// Enabled returns true if an exporter is configured through the environment.
+func Enabled() bool {
+	if v := os.Getenv("OTEL_TRACES_EXPORTER"); v != "" {
+		return v != "none"
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup configures the global tracer provider and propagators, if tracing is
+// enabled (see [Enabled]). The returned function flushes any pending spans, and
+// must be called before exiting.
+func Setup(ctx context.Context, version string) (shutdown func(context.Context) error, err error) {
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := autoexport.NewSpanExporter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName("outline-export"),
+			semconv.ServiceVersion(version),
+		),
+	)
+	if err != nil && !errors.Is(err, resource.ErrSchemaURLConflict) {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	// Allow OTEL_SERVICE_NAME/OTEL_RESOURCE_ATTRIBUTES to override the defaults.
+	res, err = resource.Merge(res, resource.Environment())
+	if err != nil && !errors.Is(err, resource.ErrSchemaURLConflict) {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a new span, using the global tracer provider. If tracing isn't
+// enabled, the span is a no-op.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(Name).Start(ctx, name, opts...)
+}
+
+// End records err on the span (if non-nil), and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
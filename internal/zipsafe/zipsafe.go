@@ -0,0 +1,186 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+// Package zipsafe checks zip archives before they are extracted, rejecting
+// entries which could escape the extraction directory (e.g. through path
+// traversal or symlinks), and archives which look like zip bombs.
+package zipsafe
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lrstanley/outline-export/internal/sanitize"
+)
+
+// Reasons zip entries are rejected.
+const (
+	RejectAbsolute  = "absolute"
+	RejectTraversal = "traversal"
+	RejectSymlink   = "symlink"
+	RejectSpecial   = "special"
+	RejectCollision = "collision"
+	RejectRatio     = "ratio"
+)
+
+// RatioMinSize is the minimum uncompressed size of an entry before the
+// compression ratio limit is applied, so small (highly compressible) files are
+// never rejected.
+const RatioMinSize = 1 << 20
+
+var (
+	// ErrTooManyFiles is returned when an archive contains more files than
+	// allowed.
+	ErrTooManyFiles = errors.New("too many files")
+
+	// ErrTooLarge is returned when the total uncompressed size of an archive is
+	// larger than allowed.
+	ErrTooLarge = errors.New("uncompressed size too large")
+)
+
+// reDrive matches names starting with a Windows drive letter (e.g. "C:\" or
+// "C:/"), but not names which just happen to have a colon as their second
+// character (e.g. "Q: FAQ").
+var reDrive = regexp.MustCompile(`^[A-Za-z]:([/\\]|$)`)
+
+// Limits are the limits applied to archives. Zero values disable the
+// respective limit.
+type Limits struct {
+	MaxFiles int   // Maximum number of files.
+	MaxSize  int64 // Maximum total uncompressed size, in bytes.
+	MaxRatio int   // Maximum compression ratio of entries larger than [RatioMinSize].
+}
+
+// CheckLimits returns an error if the archive exceeds the file count or total
+// size limits. Only the headers of the archive are used, so this is safe to call
+// before anything is decompressed.
+func CheckLimits(zr *zip.Reader, limits Limits) error {
+	var files int
+	var size uint64
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		files++
+		size += f.UncompressedSize64
+	}
+
+	if limits.MaxFiles > 0 && files > limits.MaxFiles {
+		return fmt.Errorf("%w: archive contains %d files, limit is %d", ErrTooManyFiles, files, limits.MaxFiles)
+	}
+
+	if limits.MaxSize > 0 && size > uint64(limits.MaxSize) {
+		return fmt.Errorf("%w: archive contains %d bytes, limit is %d", ErrTooLarge, size, limits.MaxSize)
+	}
+
+	return nil
+}
+
+// IsAbsolute returns true if the name of a zip entry is an absolute path
+// (including Windows drive letters), on any platform.
+func IsAbsolute(name string) bool {
+	return strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) || reDrive.MatchString(name)
+}
+
+// CheckEntry returns the reason the zip entry should be rejected, or an empty
+// string if it's safe to extract. parts are the unescaped (but unsanitized) path
+// parts of the entry (see [UnescapeParts]).
+func CheckEntry(f *zip.File, parts []string, limits Limits) string {
+	mode := f.Mode()
+
+	switch {
+	case IsAbsolute(f.Name):
+		return RejectAbsolute
+	case mode&os.ModeSymlink != 0:
+		return RejectSymlink
+	case mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket|os.ModeIrregular) != 0:
+		return RejectSpecial
+	}
+
+	for _, part := range parts {
+		if part == ".." {
+			return RejectTraversal
+		}
+	}
+
+	if limit := limits.MaxRatio; limit > 0 && f.UncompressedSize64 >= RatioMinSize &&
+		(f.CompressedSize64 == 0 || f.UncompressedSize64/f.CompressedSize64 > uint64(limit)) {
+		return RejectRatio
+	}
+
+	return ""
+}
+
+// UnescapeParts splits the name of a zip entry into its path parts, and URL
+// decodes each part.
+func UnescapeParts(name string) ([]string, error) {
+	parts := strings.Split(name, "/")
+	for i := range parts {
+		var err error
+
+		parts[i], err = url.QueryUnescape(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to unescape path part %q: %w", parts[i], err)
+		}
+	}
+	return parts, nil
+}
+
+// Entry is the sanitized name of a zip entry, or the reason it was rejected.
+type Entry struct {
+	Path   string // Unescaped (but unsanitized) path, slash-separated.
+	Name   string // Sanitized path, relative to the extraction directory.
+	Reason string // Reason the entry was rejected, if any.
+}
+
+// Entries sanitizes the names of all zip entries (using resolver), and checks if
+// they are safe to extract. Names are resolved in sorted order, so collisions
+// between sanitized names are always resolved the same way, regardless of the
+// order of entries within the archive. The returned entries are in the same
+// order as files.
+func Entries(files []*zip.File, resolver *sanitize.Resolver, limits Limits) ([]Entry, error) {
+	entries := make([]Entry, len(files))
+	parts := make([][]string, len(files))
+
+	for i, f := range files {
+		var err error
+
+		parts[i], err = UnescapeParts(f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		entries[i].Path = strings.Trim(strings.Join(parts[i], "/"), "/")
+		entries[i].Reason = CheckEntry(f, parts[i], limits)
+	}
+
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return strings.Compare(files[a].Name, files[b].Name)
+	})
+
+	for _, i := range order {
+		if entries[i].Reason != "" {
+			continue
+		}
+
+		entries[i].Name = resolver.ResolvePath(parts[i], !files[i].FileInfo().IsDir())
+		if !filepath.IsLocal(entries[i].Name) {
+			entries[i].Reason = RejectTraversal
+		}
+	}
+
+	return entries, nil
+}
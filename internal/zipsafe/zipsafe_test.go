@@ -0,0 +1,228 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package zipsafe
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lrstanley/outline-export/internal/sanitize"
+)
+
+// testEntry is an entry of an archive built by buildZip.
+type testEntry struct {
+	name string
+	mode fs.FileMode
+	data []byte
+}
+
+// buildZip builds an archive in memory with the provided entries.
+func buildZip(t *testing.T, entries ...testEntry) *zip.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			hdr.SetMode(e.mode)
+		}
+
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatalf("failed to create entry %q: %v", e.name, err)
+		}
+
+		if _, err = w.Write(e.data); err != nil {
+			t.Fatalf("failed to write entry %q: %v", e.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	return zr
+}
+
+func TestIsAbsolute(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "Engineering/Welcome.md", want: false},
+		{name: "Q: FAQ/Doc.md", want: false},
+		{name: "Q:FAQ/Doc.md", want: false},
+		{name: "a:b.md", want: false},
+		{name: "/etc/passwd", want: true},
+		{name: `\windows\system32`, want: true},
+		{name: `\\server\share\x.md`, want: true},
+		{name: "C:/x.md", want: true},
+		{name: `c:\x.md`, want: true},
+		{name: "C:", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := IsAbsolute(tt.name); got != tt.want {
+				t.Errorf("IsAbsolute(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntries(t *testing.T) {
+	t.Parallel()
+
+	limits := Limits{MaxRatio: 100}
+
+	tests := []struct {
+		entry      testEntry
+		wantName   string
+		wantReason string
+	}{
+		{entry: testEntry{name: "Engineering/Welcome.md", data: []byte("hi")}, wantName: "Engineering/Welcome.md"},
+		{entry: testEntry{name: "Engineering/"}, wantName: "Engineering"},
+		{entry: testEntry{name: "Q: FAQ/Doc.md", data: []byte("hi")}, wantName: "Q- FAQ/Doc.md"},
+		{entry: testEntry{name: "Product/%C3%9Cberblick.md"}, wantName: "Product/berblick.md"},
+		{entry: testEntry{name: "../../evil.md"}, wantReason: RejectTraversal},
+		{entry: testEntry{name: "a/../../evil.md"}, wantReason: RejectTraversal},
+		{entry: testEntry{name: "%2E%2E/evil.md"}, wantReason: RejectTraversal},
+		{entry: testEntry{name: "%2E%2E%2F%2E%2E%2Fx.md"}, wantName: "..-..-x.md"},
+		{entry: testEntry{name: "/abs.md"}, wantReason: RejectAbsolute},
+		{entry: testEntry{name: `C:\abs.md`}, wantReason: RejectAbsolute},
+		{entry: testEntry{name: "C:/abs.md"}, wantReason: RejectAbsolute},
+		{entry: testEntry{name: "link", mode: os.ModeSymlink | 0o777, data: []byte("/etc")}, wantReason: RejectSymlink},
+		{entry: testEntry{name: "fifo", mode: os.ModeNamedPipe | 0o644}, wantReason: RejectSpecial},
+		{entry: testEntry{name: "dev", mode: os.ModeDevice | 0o644}, wantReason: RejectSpecial},
+		{entry: testEntry{name: "bomb.md", data: make([]byte, 4<<20)}, wantReason: RejectRatio},
+		{entry: testEntry{name: "small.md", data: make([]byte, RatioMinSize-1)}, wantName: "small.md"},
+		{entry: testEntry{name: "???"}, wantReason: RejectTraversal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry.name, func(t *testing.T) {
+			t.Parallel()
+
+			zr := buildZip(t, tt.entry)
+
+			entries, err := Entries(zr.File, sanitize.NewResolver(sanitize.Strict), limits)
+			if err != nil {
+				t.Fatalf("Entries() error = %v", err)
+			}
+
+			if got := entries[0]; got.Name != tt.wantName || got.Reason != tt.wantReason {
+				t.Errorf("Entries(%q) = {name: %q, reason: %q}, want {name: %q, reason: %q}",
+					tt.entry.name, got.Name, got.Reason, tt.wantName, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestEntriesRatioDisabled(t *testing.T) {
+	t.Parallel()
+
+	zr := buildZip(t, testEntry{name: "bomb.md", data: make([]byte, 4<<20)})
+
+	entries, err := Entries(zr.File, sanitize.NewResolver(sanitize.Strict), Limits{})
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+
+	if entries[0].Reason != "" {
+		t.Errorf("Entries() rejected entry with %q, want no limit", entries[0].Reason)
+	}
+}
+
+func TestEntriesCollisions(t *testing.T) {
+	t.Parallel()
+
+	// The order of entries within the archive must not affect which entry gets
+	// the suffix.
+	a := buildZip(t, testEntry{name: "Docs/Welcome.md"}, testEntry{name: "Docs/-Welcome.md"})
+	b := buildZip(t, testEntry{name: "Docs/-Welcome.md"}, testEntry{name: "Docs/Welcome.md"})
+
+	ea, err := Entries(a.File, sanitize.NewResolver(sanitize.Strict), Limits{})
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+
+	eb, err := Entries(b.File, sanitize.NewResolver(sanitize.Strict), Limits{})
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+
+	if ea[0].Name != eb[1].Name || ea[1].Name != eb[0].Name {
+		t.Errorf("Entries() depends on archive order: %+v vs %+v", ea, eb)
+	}
+
+	// Entries are resolved in sorted order, so "-Welcome.md" gets the plain name.
+	if ea[1].Name != "Docs/Welcome.md" || !strings.HasPrefix(ea[0].Name, "Docs/Welcome~") {
+		t.Errorf("Entries() didn't resolve collision: %+v", ea)
+	}
+}
+
+func TestEntriesInvalidEscape(t *testing.T) {
+	t.Parallel()
+
+	zr := buildZip(t, testEntry{name: "bad%zz.md"})
+
+	if _, err := Entries(zr.File, sanitize.NewResolver(sanitize.Strict), Limits{}); err == nil {
+		t.Error("Entries() error = nil, want an error for an invalid escape")
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	t.Parallel()
+
+	many := make([]testEntry, 0, 11)
+	many = append(many, testEntry{name: "dir/"})
+	for i := range 10 {
+		many = append(many, testEntry{name: "dir/" + strings.Repeat("x", i+1) + ".md", data: []byte("x")})
+	}
+
+	tests := []struct {
+		name    string
+		entries []testEntry
+		limits  Limits
+		want    error
+	}{
+		{name: "within-limits", entries: many, limits: Limits{MaxFiles: 10, MaxSize: 10}},
+		{name: "too-many-files", entries: many, limits: Limits{MaxFiles: 9}, want: ErrTooManyFiles},
+		{name: "too-large", entries: many, limits: Limits{MaxSize: 9}, want: ErrTooLarge},
+		{name: "disabled", entries: many, limits: Limits{}},
+		{
+			name:    "oversized",
+			entries: []testEntry{{name: "big.bin", data: make([]byte, 2<<20)}},
+			limits:  Limits{MaxSize: 1 << 20},
+			want:    ErrTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := CheckLimits(buildZip(t, tt.entries...), tt.limits)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("CheckLimits() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
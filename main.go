@@ -5,286 +5,917 @@
 package main
 
 import (
-	"archive/zip"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/url"
 	"os"
-	"path"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/lrstanley/clix/v2"
 	"github.com/lrstanley/outline-export/internal/api"
+	"github.com/lrstanley/outline-export/internal/gitrepo"
+	"github.com/lrstanley/outline-export/internal/metrics"
+	"github.com/lrstanley/outline-export/internal/sanitize"
+	"github.com/lrstanley/outline-export/internal/scheduler"
+	"github.com/lrstanley/outline-export/internal/snapshot"
+	"github.com/lrstanley/outline-export/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	version = "master"
 	commit  = "latest"
 	date    = "-"
-	cli     = clix.NewWithDefaults(
+)
+
+// cli holds the parsed flags. It's initialized by [main] (see [newCLI]) rather
+// than at init, so tests don't have their own flags parsed.
+var cli *clix.CLI[Flags]
+
+// newCLI parses the command line flags.
+func newCLI() *clix.CLI[Flags] {
+	return clix.NewWithDefaults(
 		clix.WithAppInfo[Flags](clix.AppInfo{
 			Version: version,
 			Commit:  commit,
 			Date:    date,
 		}),
-		clix.WithKongOptions[Flags](kong.Vars{
-			"HTTP_TIMEOUT": api.DefaultHTTPTimeout.Round(time.Second).String(),
-		}),
+		clix.WithKongOptions[Flags](kongVars()),
 	)
-)
+}
+
+// kongVars returns the variables which can be used in flag tags.
+func kongVars() kong.Vars {
+	return kong.Vars{
+		"HTTP_TIMEOUT":        api.DefaultHTTPTimeout.Round(time.Second).String(),
+		"RETRY_MAX_ATTEMPTS":  strconv.Itoa(api.DefaultRetryMaxAttempts),
+		"RETRY_BASE_DELAY":    api.DefaultRetryBaseDelay.String(),
+		"RETRY_MAX_DELAY":     api.DefaultRetryMaxDelay.String(),
+		"RETRY_MAX_AFTER":     api.DefaultRetryMaxRetryAfter.String(),
+		"MODE_FILE_OPERATION": modeFileOperation,
+		"MODE_DOCUMENTS":      modeDocuments,
+		"REUSE_NEVER":         reuseNever,
+		"REUSE_SAME_OPTIONS":  reuseSameOptions,
+		"REUSE_ANY":           reuseAny,
+		"SANITIZE_STRICT":     sanitize.Strict,
+		"SANITIZE_UNICODE":    sanitize.Unicode,
+		"SANITIZE_WINDOWS":    sanitize.WindowsSafe,
+		"SANITIZE_SLUG":       sanitize.Slug,
+		"GIT_BRANCH":          gitrepo.DefaultBranch,
+		"GIT_AUTHOR_NAME":     gitrepo.DefaultAuthorName,
+		"GIT_AUTHOR_EMAIL":    gitrepo.DefaultAuthorEmail,
+		"HISTORY":             strconv.Itoa(scheduler.DefaultHistory),
+	}
+}
 
 type Flags struct {
-	URL                string        `name:"url" env:"URL" required:"" help:"URL of the Outline server"`
-	Token              string        `name:"token" env:"TOKEN" required:"" help:"Token for the Outline server"`
-	Format             string        `name:"format" env:"FORMAT" required:"" enum:"markdown,html,json" help:"Format of the export"`
-	ExcludeAttachments bool          `name:"exclude-attachments" env:"EXCLUDE_ATTACHMENTS" help:"Exclude attachments from the export"`
-	ExcludePrivate     bool          `name:"exclude-private" env:"EXCLUDE_PRIVATE" help:"Exclude private collections from the export"`
-	Extract            bool          `name:"extract" env:"EXTRACT" help:"Extract the export into the target directory"`
-	ExportPath         string        `name:"export-path" env:"EXPORT_PATH" required:"" help:"Path to export the file to. If extract is enabled, this will be the directory to extract the export to."`
-	Filters            []string      `name:"filters" env:"FILTERS" help:"Filters the export to only include certain files (when using --extract). This is a glob pattern, and it matches the files/folders inside of the export zip, not necessarily collections/document exact names."`
-	HTTPTimeout        time.Duration `name:"http-timeout" env:"HTTP_TIMEOUT" default:"${HTTP_TIMEOUT}" help:"Timeout for HTTP requests to the Outline server"`
-	RewriteRedirect    bool          `name:"rewrite-redirect" env:"REWRITE_REDIRECT" help:"Rewrite redirect URL to match Base URL"`
+	Config              string        `name:"config" env:"CONFIG" type:"existingfile" help:"Config file (.yaml, .yml, or .toml) defining Outline instances and export jobs. Flags and environment variables override values from the config file"`
+	Jobs                []string      `name:"job" env:"JOBS" help:"Only run the provided jobs from the config file (by 'instance/job', job name, or instance name, can be repeated). Defaults to all jobs"`
+	URL                 string        `name:"url" env:"URL" help:"URL of the Outline server (required, unless provided through --config)"`
+	Token               string        `name:"token" env:"TOKEN" help:"Token for the Outline server. One of --token, --token-file, or --token-command is required, unless provided through --config. Prefer --token-file or --token-command, as flags and environment variables may be visible to other users/processes"`
+	TokenFile           string        `name:"token-file" env:"TOKEN_FILE" help:"File containing the token for the Outline server. The file is read on each run, so the token can be rotated without restarting the daemon"`
+	TokenCommand        string        `name:"token-command" env:"TOKEN_COMMAND" help:"Command (ran through the system shell) which prints the token for the Outline server to stdout (e.g. 'op read op://vault/outline/token'). The command is ran on each run"`
+	Mode                string        `name:"mode" env:"MODE" default:"${MODE_FILE_OPERATION}" enum:"${MODE_FILE_OPERATION},${MODE_DOCUMENTS}" help:"Export engine to use. '${MODE_FILE_OPERATION}' generates a workspace/collection export through Outline, '${MODE_DOCUMENTS}' fetches each document individually (markdown only, without attachments), and can resume interrupted exports"`
+	Concurrency         int           `name:"concurrency" env:"CONCURRENCY" default:"4" help:"Number of documents to fetch concurrently (when using --mode=${MODE_DOCUMENTS})"`
+	Format              []string      `name:"format" env:"FORMAT" help:"Formats of the export: markdown, html, or json (required, unless provided through --config). When multiple formats are provided, they are exported concurrently, and each is written to a format-specific path within the export path (<export-path>/<format>[.zip])"`
+	ExcludeAttachments  bool          `name:"exclude-attachments" env:"EXCLUDE_ATTACHMENTS" help:"Exclude attachments from the export"`
+	ExcludePrivate      bool          `name:"exclude-private" env:"EXCLUDE_PRIVATE" help:"Exclude private collections from the export"`
+	Extract             bool          `name:"extract" env:"EXTRACT" help:"Extract the export into the target directory"`
+	ExportPath          string        `name:"export-path" env:"EXPORT_PATH" help:"Path to export the file to (required, unless provided through --config). If extract is enabled, this will be the directory to extract the export to. When exporting specific collections, this is the directory each collection is written to."`
+	Collections         []string      `name:"collection" env:"COLLECTIONS" help:"Only export the provided collections (by ID or name, can be repeated). Each collection is exported separately, and written to its own path within the export path."`
+	Mirror              bool          `name:"mirror" env:"MIRROR" help:"Make the export path exactly match the export, removing files which are no longer part of it (e.g. renamed or deleted documents). The export is extracted into a staging directory next to the export path, which is swapped into place once complete, so readers never see a partially written export. Implies --extract"`
+	Filters             []string      `name:"filters" env:"FILTERS" help:"Deprecated, use --include and --exclude instead. Only includes files/folders inside of the export zip whose sanitized path matches one of these glob patterns (filepath.Match syntax, when using --extract)"`
+	Include             []string      `name:"include" env:"INCLUDE" help:"Only include files/folders matching these rules (can be repeated). Rules are gitignore-style glob patterns ('**' matches any number of folders, patterns without a slash match at any depth, and matching a folder includes everything within it), or regular expressions when prefixed with 're:'. Rules prefixed with '!' negate earlier rules, and the last matching rule wins. Rules match paths within the export (e.g. 'Engineering/Runbooks/**'), before file names are sanitized"`
+	Exclude             []string      `name:"exclude" env:"EXCLUDE" help:"Exclude files/folders matching these rules (can be repeated, same syntax as --include). Takes precedence over --include"`
+	IncludeCollections  []string      `name:"include-collection" env:"INCLUDE_COLLECTIONS" help:"Only include collections with names matching these rules (can be repeated). Rules are glob patterns, or regular expressions when prefixed with 're:', and are case-insensitive"`
+	ExcludeCollections  []string      `name:"exclude-collection" env:"EXCLUDE_COLLECTIONS" help:"Exclude collections with names matching these rules (can be repeated, same syntax as --include-collection). Takes precedence over --include-collection"`
+	Sanitize            string        `name:"sanitize" env:"SANITIZE" default:"${SANITIZE_STRICT}" enum:"${SANITIZE_STRICT},${SANITIZE_UNICODE},${SANITIZE_WINDOWS},${SANITIZE_SLUG}" help:"Strategy for sanitizing file and folder names. '${SANITIZE_STRICT}' only keeps ASCII letters, digits and some punctuation, '${SANITIZE_UNICODE}' keeps letters and digits in any script (only replacing characters filesystems reject), '${SANITIZE_WINDOWS}' also replaces characters and names Windows rejects (and treats names differing only in case as collisions), '${SANITIZE_SLUG}' lowercases names and replaces everything but letters and digits with dashes. Names which collide once sanitized get a stable suffix (e.g. 'name~1a2b3c.md')"`
+	Reuse               string        `name:"reuse" env:"REUSE" default:"${REUSE_SAME_OPTIONS}" enum:"${REUSE_NEVER},${REUSE_SAME_OPTIONS},${REUSE_ANY}" help:"Policy for reusing existing exports (e.g. from an interrupted run). '${REUSE_NEVER}' always generates a new export, '${REUSE_SAME_OPTIONS}' only reuses exports generated by this tool with the same format, collection, and attachment/private options (recorded in --reuse-state-file), '${REUSE_ANY}' reuses any export with the same format and collection"`
+	ReuseMaxAge         time.Duration `name:"reuse-max-age" env:"REUSE_MAX_AGE" default:"1h" help:"Maximum age of existing exports which can be reused"`
+	ReuseStateFile      string        `name:"reuse-state-file" env:"REUSE_STATE_FILE" help:"File used to record the options of generated exports (when using --reuse=${REUSE_SAME_OPTIONS}). Defaults to 'outline-export/exports.json' within the user cache directory"`
+	MaxExtractSize      byteSize      `name:"max-extract-size" env:"MAX_EXTRACT_SIZE" default:"10GiB" help:"Maximum total uncompressed size of an export (when using --extract), to protect against zip bombs. 0 disables the limit"`
+	MaxExtractFiles     int           `name:"max-extract-files" env:"MAX_EXTRACT_FILES" default:"100000" help:"Maximum number of files in an export (when using --extract). 0 disables the limit"`
+	MaxCompressionRatio int           `name:"max-compression-ratio" env:"MAX_COMPRESSION_RATIO" default:"100" help:"Maximum compression ratio of a single file larger than 1MiB (when using --extract). Files exceeding it are rejected. 0 disables the limit"`
+	FileMode            fileMode      `name:"file-mode" env:"FILE_MODE" default:"0600" help:"Permissions of written files (in octal)"`
+	DirMode             fileMode      `name:"dir-mode" env:"DIR_MODE" default:"0700" help:"Permissions of created directories (in octal, when using --extract or --mode=${MODE_DOCUMENTS})"`
+	UID                 int           `name:"uid" env:"FILE_UID" default:"-1" help:"User ID to set as the owner of written files and directories (-1 leaves the owner unchanged)"`
+	GID                 int           `name:"gid" env:"FILE_GID" default:"-1" help:"Group ID to set as the group of written files and directories (-1 leaves the group unchanged)"`
+	Snapshot            bool          `name:"snapshot" env:"SNAPSHOT" help:"Write each export to a new timestamped snapshot (<export-path>/<timestamp>-<format>[.zip]), and point a 'latest' symlink at it"`
+	KeepLast            int           `name:"keep-last" env:"KEEP_LAST" help:"Keep the N most recent snapshots (when using --snapshot). If no --keep-* flags are provided, all snapshots are kept"`
+	KeepDaily           int           `name:"keep-daily" env:"KEEP_DAILY" help:"Keep the most recent snapshot of each of the last N days (when using --snapshot)"`
+	KeepWeekly          int           `name:"keep-weekly" env:"KEEP_WEEKLY" help:"Keep the most recent snapshot of each of the last N weeks (when using --snapshot)"`
+	KeepMonthly         int           `name:"keep-monthly" env:"KEEP_MONTHLY" help:"Keep the most recent snapshot of each of the last N months (when using --snapshot)"`
+	Git                 bool          `name:"git" env:"GIT" help:"Store the export in a git repository at the export path (initialized if needed), committing each export. Implies --extract"`
+	GitBranch           string        `name:"git-branch" env:"GIT_BRANCH" default:"${GIT_BRANCH}" help:"Branch to commit exports to (when using --git)"`
+	GitAuthorName       string        `name:"git-author-name" env:"GIT_AUTHOR_NAME" default:"${GIT_AUTHOR_NAME}" help:"Author name used for commits (when using --git)"`
+	GitAuthorEmail      string        `name:"git-author-email" env:"GIT_AUTHOR_EMAIL" default:"${GIT_AUTHOR_EMAIL}" help:"Author email used for commits (when using --git)"`
+	GitPushRemote       string        `name:"git-push-remote" env:"GIT_PUSH_REMOTE" help:"Remote (local path or file:// URL) to push the branch to after each commit (when using --git)"`
+	HTTPTimeout         time.Duration `name:"http-timeout" env:"HTTP_TIMEOUT" default:"${HTTP_TIMEOUT}" help:"Timeout for HTTP requests to the Outline server"`
+	RewriteRedirect     bool          `name:"rewrite-redirect" env:"REWRITE_REDIRECT" help:"Rewrite redirect URL to match Base URL"`
+	RetryMaxAttempts    int           `name:"retry-max-attempts" env:"RETRY_MAX_ATTEMPTS" default:"${RETRY_MAX_ATTEMPTS}" help:"Maximum number of attempts for requests which fail with a transient error (1 disables retries)"`
+	RetryBaseDelay      time.Duration `name:"retry-base-delay" env:"RETRY_BASE_DELAY" default:"${RETRY_BASE_DELAY}" help:"Delay before the first retry, doubled on each subsequent retry"`
+	RetryMaxDelay       time.Duration `name:"retry-max-delay" env:"RETRY_MAX_DELAY" default:"${RETRY_MAX_DELAY}" help:"Maximum delay between retries (Retry-After headers sent by the server take precedence, see --retry-max-after)"`
+	RetryMaxAfter       time.Duration `name:"retry-max-after" env:"RETRY_MAX_AFTER" default:"${RETRY_MAX_AFTER}" help:"Maximum delay requested by the server through Retry-After which is honored. Requests fail rather than being retried early if the server asks to wait longer (0 disables the limit)"`
+	CAFile              string        `name:"ca-file" env:"CA_FILE" help:"PEM bundle of additional certificate authorities to trust (e.g. an internal CA), on top of the system certificate pool"`
+	ClientCert          string        `name:"client-cert" env:"CLIENT_CERT" help:"PEM client certificate to present to servers which require client certificates (mTLS). Requires --client-key"`
+	ClientKey           string        `name:"client-key" env:"CLIENT_KEY" help:"PEM private key of the client certificate (when using --client-cert)"`
+	TLSMinVersion       string        `name:"tls-min-version" env:"TLS_MIN_VERSION" default:"1.2" enum:"1.0,1.1,1.2,1.3" help:"Minimum TLS version"`
+	ProxyURL            string        `name:"proxy-url" env:"PROXY_URL" help:"Proxy to use for all requests (http://, https://, or socks5://). Defaults to the proxy from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables"`
+	InsecureSkipVerify  bool          `name:"insecure-skip-verify" env:"INSECURE_SKIP_VERIFY" help:"Disable verification of server certificates (insecure, only use for testing)"`
+	NotifyURL           []string      `name:"notify-url" env:"NOTIFY_URL" sep:" " help:"Send notifications to this URL (can be repeated, space separated in env). http(s):// for a generic JSON webhook, slack+https:// or mattermost+https:// for incoming webhooks, or smtp(s)://user:pass@host:port/?from=..&to=.. for email"`
+	NotifyOn            []string      `name:"notify-on" env:"NOTIFY_ON" default:"failure" enum:"success,failure,change" help:"Events to send notifications for. 'change' is sent instead of 'success' when files were added, modified or removed"`
+	NotifyTemplate      string        `name:"notify-template" env:"NOTIFY_TEMPLATE" type:"existingfile" help:"Go text/template file which overrides the 'subject' and/or 'body' notification templates"`
+	MetricsTextfile     string        `name:"metrics-textfile" env:"METRICS_TEXTFILE" help:"Write Prometheus metrics to this path after each run, in node_exporter textfile collector format (e.g. /var/lib/node_exporter/outline-export.prom)"`
+
+	Export  ExportCommand  `cmd:"" default:"1" help:"Run a single export (default)"`
+	Daemon  DaemonCommand  `cmd:"" help:"Run exports on a schedule, until interrupted"`
+	Cleanup CleanupCommand `cmd:"" help:"Delete export file operations matching the provided selectors (e.g. exports left behind by interrupted runs)"`
+}
+
+// ExportCommand runs a single export. It has no flags of its own, as all export
+// flags are global (so they can be shared with the daemon command).
+type ExportCommand struct{}
+
+// runResult contains the details of a single export run.
+type runResult struct {
+	Job             string   `json:"job,omitempty"`
+	Mode            string   `json:"mode"`
+	Formats         []string `json:"formats"`
+	Path            string   `json:"path"`
+	Collections     []string `json:"collections,omitempty"`
+	FileOperations  []string `json:"file_operations,omitempty"`
+	BytesDownloaded int64    `json:"bytes_downloaded"`
+	FilesExtracted  int      `json:"files_extracted"`
+	FilesSkipped    int      `json:"files_skipped"`
+
+	// Rejected are the zip entries which weren't extracted, as they're unsafe
+	// (e.g. symlinks, or paths which escape the export path).
+	Rejected []*rejectedEntry `json:"rejected,omitempty"`
+
+	// Changes is the number of files which were added, modified or removed
+	// compared to the previous export. Archives are always counted as changed.
+	Changes int `json:"changes"`
+}
+
+// addBytes records n downloaded bytes.
+func (r *runResult) addBytes(n int64) {
+	r.BytesDownloaded += n
+	metrics.BytesDownloaded.Add(float64(n))
+}
+
+// addExtracted records a file which was written to the export path.
+func (r *runResult) addExtracted() {
+	r.FilesExtracted++
+	metrics.FilesExtracted.Inc()
+}
+
+// addChanged records a file which was added, modified or removed.
+func (r *runResult) addChanged(n int) {
+	r.Changes += n
+}
+
+// addSkipped records a file which was skipped for the given reason.
+func (r *runResult) addSkipped(reason string) {
+	r.FilesSkipped++
+	metrics.FilesSkipped.WithLabelValues(reason).Inc()
 }
 
 func main() {
-	ctx := context.Background()
+	cli = newCLI()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	logger := cli.GetLogger()
 
-	client, err := api.NewClient(&api.Config{
-		BaseURL:     cli.Flags.URL,
-		Token:       cli.Flags.Token,
-		Logger:      logger,
-		HTTPTimeout: cli.Flags.HTTPTimeout,
-		RewriteRedirect: cli.Flags.RewriteRedirect,
-	})
+	shutdownTracing, err := tracing.Setup(ctx, version)
 	if err != nil {
-		logger.Error("failed to create client", "error", err)
-		os.Exit(1)
-	}
-
-	var format api.ExportFormat
-	switch cli.Flags.Format {
-	case "markdown":
-		format = api.ExportFormatMarkdown
-	case "html":
-		format = api.ExportFormatHTML
-	case "json":
-		format = api.ExportFormatJSON
+		fatal(logger, "failed to setup tracing", err)
+	}
+
+	notifier, err := newRunNotifier()
+	if err != nil {
+		fatal(logger, "failed to setup notifications", err)
+	}
+
+	command := cli.Context.Command()
+
+	jobs, err := resolveJobs(command != "cleanup")
+	if err != nil {
+		fatal(logger, "invalid configuration", err)
+	}
+
+	msg := "export failed"
+
+	switch command {
+	case "daemon":
+		err = runDaemon(ctx, logger, notifier, jobs)
+	case "cleanup":
+		msg = "cleanup failed"
+		err = runCleanup(ctx, logger, jobs)
 	default:
-		logger.Error("invalid format", "format", cli.Flags.Format)
-		os.Exit(1)
+		_, err = runJobs(ctx, logger, notifier, jobs)
 	}
 
-	var operation *api.FileOperation
+	// Flush any pending spans before exiting (fatal calls os.Exit).
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	if terr := shutdownTracing(shutdownCtx); terr != nil {
+		logger.ErrorContext(ctx, "failed to flush traces", "error", terr)
+	}
+	cancel()
 
-	for op, err := range client.ListFileOperations(ctx) {
+	if err != nil {
+		fatal(logger, msg, err)
+	}
+}
+
+// runJobs runs each job in order. A failed job doesn't prevent the remaining
+// jobs from running, and all errors are returned.
+func runJobs(ctx context.Context, logger *slog.Logger, notifier *runNotifier, jobs []*exportJob) ([]*runResult, error) {
+	results := make([]*runResult, 0, len(jobs))
+	var errs []error
+
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		result, err := runAndReport(ctx, logger, notifier, job)
+		if result != nil {
+			results = append(results, result)
+		}
 		if err != nil {
-			logger.Error("failed to list file operations", "error", err)
-			os.Exit(1)
+			if job.name != "" {
+				err = fmt.Errorf("job %q: %w", job.name, err)
+			}
+			errs = append(errs, err)
 		}
+	}
 
-		if op.Type != api.FileOperationTypeExport || op.Format != format || time.Since(op.CreatedAt) > 1*time.Hour {
-			continue
+	return results, errors.Join(errs...)
+}
+
+// runAndReport runs a single export job (see [run]), recording the result in the
+// run metrics, writing them to --metrics-textfile (if configured), and sending
+// notifications (if configured).
+func runAndReport(ctx context.Context, logger *slog.Logger, notifier *runNotifier, job *exportJob) (*runResult, error) {
+	// The export uses the global flags, so swap in the flags of the job while
+	// it's running. Jobs are never run concurrently.
+	base := cli.Flags
+	cli.Flags = job.flags
+	defer func() { cli.Flags = base }()
+
+	if job.name != "" {
+		logger = logger.With("job", job.name)
+		logger.InfoContext(ctx, "starting job")
+	}
+
+	start := time.Now()
+	result, err := run(ctx, logger)
+	if result != nil {
+		result.Job = job.name
+	}
+	metrics.ObserveRun(job.name, start, err)
+
+	if cli.Flags.MetricsTextfile != "" {
+		if merr := metrics.WriteTextfile(cli.Flags.MetricsTextfile); merr != nil {
+			logger.ErrorContext(ctx, "failed to write metrics", "error", merr)
 		}
+	}
 
-		if op.State == api.FileOperationStateComplete || op.State == api.FileOperationStateCreating || op.State == api.FileOperationStateUploading {
-			logger.Info("found existing export", "id", op.ID, "name", op.Name)
-			operation = op
-			break
+	notifier.notify(ctx, logger, start, result, err)
+	return result, err
+}
+
+// tlsVersions maps the --tls-min-version values to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newClient creates an API client, based on the provided flags.
+func newClient(ctx context.Context, logger *slog.Logger) (*api.Client, error) {
+	token, err := resolveToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if cli.Flags.InsecureSkipVerify {
+		logger.WarnContext(ctx, "server certificate verification is disabled (--insecure-skip-verify)")
+	}
+
+	return api.NewClient(&api.Config{
+		BaseURL:         cli.Flags.URL,
+		Token:           token,
+		Logger:          logger,
+		HTTPTimeout:     cli.Flags.HTTPTimeout,
+		RewriteRedirect: cli.Flags.RewriteRedirect,
+		Retry: &api.RetryPolicy{
+			MaxAttempts:   cli.Flags.RetryMaxAttempts,
+			BaseDelay:     cli.Flags.RetryBaseDelay,
+			MaxDelay:      cli.Flags.RetryMaxDelay,
+			MaxRetryAfter: cli.Flags.RetryMaxAfter,
+			Jitter:        api.DefaultRetryJitter,
+		},
+		CAFile:             cli.Flags.CAFile,
+		ClientCertFile:     cli.Flags.ClientCert,
+		ClientKeyFile:      cli.Flags.ClientKey,
+		MinTLSVersion:      tlsVersions[cli.Flags.TLSMinVersion],
+		ProxyURL:           cli.Flags.ProxyURL,
+		InsecureSkipVerify: cli.Flags.InsecureSkipVerify,
+	},
+		api.WithUserAgent(api.DefaultUserAgent, version),
+		api.WithHooks(metrics.APIHooks{}),
+	)
+}
+
+// Ensure the Prometheus hooks can be used with the API client.
+var _ api.Hooks = metrics.APIHooks{}
+
+// run runs a single export, based on the provided flags.
+func run(ctx context.Context, logger *slog.Logger) (result *runResult, err error) {
+	result = &runResult{
+		Mode:    cli.Flags.Mode,
+		Formats: cli.Flags.Format,
+		Path:    cli.Flags.ExportPath,
+	}
+
+	ctx, span := tracing.Start(ctx, "export", trace.WithAttributes(
+		attribute.String("outline.mode", result.Mode),
+		attribute.StringSlice("outline.formats", result.Formats),
+	))
+	defer func() {
+		span.SetAttributes(
+			attribute.String("outline.export_path", result.Path),
+			attribute.StringSlice("outline.file_operation_ids", result.FileOperations),
+			attribute.Int64("outline.bytes_downloaded", result.BytesDownloaded),
+			attribute.Int("outline.files_extracted", result.FilesExtracted),
+			attribute.Int("outline.files_skipped", result.FilesSkipped),
+		)
+		tracing.End(span, err)
+	}()
+
+	client, err := newClient(ctx, logger)
+	if err != nil {
+		return result, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	formats := make([]api.ExportFormat, 0, len(cli.Flags.Format))
+	for _, name := range cli.Flags.Format {
+		format, ok := exportFormats[name]
+		if !ok {
+			return result, fmt.Errorf("invalid format: %q", name)
+		}
+
+		if cli.Flags.Mode == modeDocuments && format != api.ExportFormatMarkdown {
+			return result, fmt.Errorf("only the markdown format is supported in documents mode, got %q", name)
 		}
+		formats = append(formats, format)
 	}
 
-	if operation == nil {
-		operation, err = client.GenerateExport(ctx, format, !cli.Flags.ExcludeAttachments, !cli.Flags.ExcludePrivate)
+	if cli.Flags.Mirror {
+		cli.Flags.Extract = true
+	}
+
+	filter, err := newExportFilter(cli.Flags)
+	if err != nil {
+		return result, err
+	}
+
+	if len(cli.Flags.Filters) > 0 {
+		slog.WarnContext(
+			ctx,
+			"--filters is deprecated and only applies with --extract, use --include and --exclude instead",
+			"filters", cli.Flags.Filters,
+		)
+	}
+
+	if cli.Flags.Snapshot {
+		if cli.Flags.Git {
+			return result, errors.New("--snapshot and --git cannot be used together")
+		}
+
+		root := cli.Flags.ExportPath
+		name := snapshot.Name(
+			time.Now(),
+			strings.Join(cli.Flags.Format, "-"),
+			!cli.Flags.Extract && cli.Flags.Mode == modeFileOperation && len(cli.Flags.Collections) == 0 && len(formats) == 1,
+		)
+
+		if err = os.MkdirAll(root, 0o700); err != nil {
+			return result, fmt.Errorf("failed to create snapshot directory %q: %w", root, err)
+		}
+
+		// Write into a partial snapshot, which is only moved into place once the
+		// export completes.
+		cli.Flags.ExportPath = snapshot.PartialPath(root, name)
+
+		defer func() {
+			cli.Flags.ExportPath = root
+
+			if err == nil {
+				err = completeSnapshot(ctx, root, name, result)
+			}
+
+			// Also covers snapshots which couldn't be completed (e.g. because a
+			// snapshot with the same name already exists).
+			if err != nil {
+				if derr := snapshot.Discard(root, name); derr != nil {
+					logger.WarnContext(ctx, "failed to remove partial snapshot", "error", derr)
+				}
+			}
+		}()
+	}
+
+	var repo *gitrepo.Repo
+	if cli.Flags.Git {
+		cli.Flags.Extract = true
+
+		repo, err = openGitRepo()
 		if err != nil {
-			logger.Error("failed to generate export", "error", err)
-			os.Exit(1)
+			return result, fmt.Errorf("failed to open git repository: %w", err)
 		}
 	}
 
-	// Wait for the operation to complete.
-	tctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
-	defer cancel()
+	if cli.Flags.Mode == modeDocuments {
+		err = runDocumentExport(ctx, client, filter, repo, result)
+		if err != nil {
+			return result, fmt.Errorf("failed to export documents: %w", err)
+		}
+		logger.InfoContext(ctx, "export completed")
 
-	operation, err = client.WaitForFileOperation(tctx, operation.ID)
-	if err != nil {
-		logger.Error("failed to wait for file operation", "error", err)
-		os.Exit(1)
+		if repo != nil {
+			if err = commitGitSnapshot(ctx, repo, nil, result); err != nil {
+				return result, fmt.Errorf("failed to commit export: %w", err)
+			}
+		}
+		return result, nil
 	}
 
-	err = downloadExport(ctx, client, operation)
+	if repo != nil {
+		// Download into a staging directory, which only replaces the working tree
+		// once all downloads complete, so a failed export leaves it untouched.
+		root := cli.Flags.ExportPath
+
+		staging, serr := repo.Staging()
+		if serr != nil {
+			return result, serr
+		}
+		cli.Flags.ExportPath = staging
+
+		defer func() {
+			cli.Flags.ExportPath = root
+
+			// Only left behind if the export failed.
+			if rerr := os.RemoveAll(staging); rerr != nil {
+				logger.WarnContext(ctx, "failed to remove staging directory", "error", rerr)
+			}
+		}()
+	}
+
+	targets, err := resolveTargets(ctx, client, formats, filter)
 	if err != nil {
-		logger.Error("failed to download export", "error", err)
-		os.Exit(1)
+		return result, fmt.Errorf("failed to resolve export targets: %w", err)
 	}
-	logger.Info("export downloaded")
 
-	// Delete all recently created exports, within the last 1 hour, that match our format.
-	for op, err := range client.ListFileOperations(ctx) {
-		if err != nil {
-			logger.Error("failed to list file operations", "error", err)
-			os.Exit(1)
+	for _, target := range targets {
+		if target.collection != nil && !slices.Contains(result.Collections, target.collection.Name) {
+			result.Collections = append(result.Collections, target.collection.Name)
 		}
+	}
+
+	state, serr := loadReuseState(cli.Flags.ReuseStateFile)
+	if serr != nil {
+		logger.WarnContext(ctx, "failed to load reuse state, exports will not be recorded", "error", serr)
+	}
 
-		if op.Type != api.FileOperationTypeExport || op.Format != format || op.State == api.FileOperationStateError || time.Since(op.CreatedAt) > 1*time.Hour {
+	// Start all exports (or reuse existing ones) before waiting on any of them, so
+	// Outline can process them concurrently.
+	if err = findExistingExports(ctx, client, targets, state); err != nil {
+		return result, fmt.Errorf("failed to list file operations: %w", err)
+	}
+
+	var generated []*api.FileOperation
+
+	defer func() {
+		if err == nil || len(generated) == 0 {
+			return
+		}
+
+		// Don't leave the exports generated by a failed run behind, as nothing will
+		// download them. Exports which couldn't be deleted are kept in the reuse
+		// state, so a later run can still use them.
+		for _, op := range deleteGeneratedExports(ctx, client, generated) {
+			state.remove(op.ID)
+		}
+
+		if serr := state.save(cli.Flags.ReuseMaxAge); serr != nil {
+			logger.WarnContext(ctx, "failed to save reuse state", "error", serr)
+		}
+	}()
+
+	for _, target := range targets {
+		if target.operation != nil {
 			continue
 		}
 
-		err = client.DeleteFileOperation(ctx, op.ID)
+		if target.collection != nil {
+			target.operation, err = client.GenerateCollectionExport(ctx, target.collection.ID, target.format, !cli.Flags.ExcludeAttachments)
+		} else {
+			target.operation, err = client.GenerateExport(ctx, target.format, !cli.Flags.ExcludeAttachments, !cli.Flags.ExcludePrivate)
+		}
 		if err != nil {
-			logger.Error(
-				"failed to delete export",
-				"id", op.ID,
-				"name", op.Name,
-				"error", err,
-			)
-			continue
+			return result, fmt.Errorf("failed to generate export: %w", err)
 		}
 
-		logger.Info("deleted export", "id", op.ID, "name", op.Name)
+		generated = append(generated, target.operation)
+		state.record(cli.Flags.URL, target.operation, target.options())
 	}
-}
 
-var (
-	reInvalid     = regexp.MustCompile(`[^a-zA-Z0-9_.~\[\]()& -]+`)
-	reCleanDashes = regexp.MustCompile(`-+`)
-)
+	// Persist the state before waiting, so the exports can be reused if the process
+	// is killed before it can clean up after itself.
+	if serr = state.save(cli.Flags.ReuseMaxAge); serr != nil {
+		logger.WarnContext(ctx, "failed to save reuse state", "error", serr)
+	}
 
-func downloadExport(ctx context.Context, client *api.Client, operation *api.FileOperation) error {
-	// Download the export.
-	reader, err := client.DownloadFileExport(ctx, operation.ID)
-	if reader != nil {
-		defer reader.Close()
+	for _, target := range targets {
+		result.FileOperations = append(result.FileOperations, target.operation.ID)
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to download export: %w", err)
+	if err = waitForTargets(ctx, client, targets); err != nil {
+		return result, err
 	}
 
-	if !cli.Flags.Extract {
-		err = os.MkdirAll(path.Dir(cli.Flags.ExportPath), 0o700)
+	for _, target := range targets {
+		err = downloadExport(ctx, client, target, filter, result)
 		if err != nil {
-			return fmt.Errorf("failed to create export directory %q: %w", cli.Flags.ExportPath, err)
+			return result, fmt.Errorf("failed to download export: %w", err)
+		}
+		logger.InfoContext(ctx, "export downloaded", "format", target.format, "path", target.path)
+	}
+
+	if repo != nil {
+		// Replace the working tree with the new export.
+		if err = repo.Replace(cli.Flags.ExportPath); err != nil {
+			return result, fmt.Errorf("failed to replace git working tree: %w", err)
 		}
 
-		f, err := os.OpenFile(cli.Flags.ExportPath, os.O_CREATE|os.O_WRONLY, 0o600)
-		if err != nil {
-			return fmt.Errorf("failed to initialize export file %q: %w", cli.Flags.ExportPath, err)
+		if err = commitGitSnapshot(ctx, repo, targets, result); err != nil {
+			return result, fmt.Errorf("failed to commit export: %w", err)
 		}
+	}
 
-		_, err = io.Copy(f, reader)
+	// Only delete the exports this run created or reused, so exports started by
+	// others (e.g. from the Outline UI, or another instance of this tool) are left
+	// alone.
+	for _, target := range targets {
+		err = client.DeleteFileOperation(ctx, target.operation.ID)
 		if err != nil {
-			return fmt.Errorf("failed to copy export to file %q: %w", cli.Flags.ExportPath, err)
+			logger.ErrorContext(
+				ctx, "failed to delete export",
+				"id", target.operation.ID,
+				"name", target.operation.Name,
+				"error", err,
+			)
+			continue
 		}
 
-		slog.InfoContext(ctx, "export file written", "file", cli.Flags.ExportPath)
-		return nil
+		state.remove(target.operation.ID)
+		logger.InfoContext(ctx, "deleted export", "id", target.operation.ID, "name", target.operation.Name)
 	}
 
-	err = os.MkdirAll(cli.Flags.ExportPath, 0o700)
-	if err != nil {
-		return fmt.Errorf("failed to create export directory %q: %w", cli.Flags.ExportPath, err)
+	if serr = state.save(cli.Flags.ReuseMaxAge); serr != nil {
+		logger.WarnContext(ctx, "failed to save reuse state", "error", serr)
 	}
 
-	tmp, err := os.CreateTemp(os.TempDir(), fmt.Sprintf("outline-export-%s-*.zip", operation.ID))
-	if err != nil {
-		return fmt.Errorf("failed to create temporary file: %w", err)
+	return result, nil
+}
+
+// generatedCleanupTimeout is the maximum time spent deleting exports generated by
+// a failed run.
+const generatedCleanupTimeout = 30 * time.Second
+
+// deleteGeneratedExports deletes exports generated by a run which failed before
+// they could be used, returning the ones which were deleted. Deletion continues
+// even if ctx was canceled (e.g. the run was interrupted), up to
+// [generatedCleanupTimeout].
+func deleteGeneratedExports(ctx context.Context, client *api.Client, ops []*api.FileOperation) []*api.FileOperation {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), generatedCleanupTimeout)
+	defer cancel()
+
+	deleted := make([]*api.FileOperation, 0, len(ops))
+	for _, op := range ops {
+		if err := client.DeleteFileOperation(ctx, op.ID); err != nil {
+			slog.ErrorContext(ctx, "failed to delete generated export", "id", op.ID, "name", op.Name, "error", err)
+			continue
+		}
+
+		deleted = append(deleted, op)
+		slog.InfoContext(ctx, "deleted generated export", "id", op.ID, "name", op.Name)
 	}
-	defer os.Remove(tmp.Name())
+	return deleted
+}
 
-	length, err := io.Copy(tmp, reader)
-	if err != nil {
-		return fmt.Errorf("failed to stream export to temporary file: %w", err)
+// exportFormats maps the --format values to export formats.
+var exportFormats = map[string]api.ExportFormat{
+	"markdown": api.ExportFormatMarkdown,
+	"html":     api.ExportFormatHTML,
+	"json":     api.ExportFormatJSON,
+}
+
+// exportTarget is a single export (either of the entire workspace, or of a single
+// collection), and where it should be written to.
+type exportTarget struct {
+	collection *api.Collection // Nil when exporting all collections.
+	format     api.ExportFormat
+	path       string
+	operation  *api.FileOperation
+}
+
+// collectionID returns the ID of the collection being exported, or an empty
+// string when exporting all collections.
+func (t *exportTarget) collectionID() string {
+	if t.collection == nil {
+		return ""
 	}
+	return t.collection.ID
+}
 
-	zr, err := zip.NewReader(tmp, length)
-	if err != nil {
-		return fmt.Errorf("failed to create zip reader: %w", err)
+// options returns the options the export of the target is requested with.
+func (t *exportTarget) options() exportOptions {
+	return exportOptions{
+		Format:             t.format,
+		CollectionID:       t.collectionID(),
+		IncludeAttachments: !cli.Flags.ExcludeAttachments,
+		// Private collections are only excluded from workspace exports.
+		IncludePrivate: t.collection != nil || !cli.Flags.ExcludePrivate,
 	}
+}
 
-	for _, f := range zr.File {
-		// Sanitize parts.
-		parts := strings.Split(f.Name, "/")
-		for i := range parts {
-			// URL decode the part.
-			parts[i], err = url.QueryUnescape(parts[i])
-			if err != nil {
-				return fmt.Errorf("failed to unescape path part %q: %w", parts[i], err)
+// resolveTargets returns the exports that should be generated, for each format.
+// If no collections were requested, a single target for the entire workspace is
+// returned (per format), otherwise each collection is written to its own path
+// within the export path. When exporting multiple formats, each format is written
+// to its own path within the export path.
+func resolveTargets(
+	ctx context.Context,
+	client *api.Client,
+	formats []api.ExportFormat,
+	filter *exportFilter,
+) ([]*exportTarget, error) {
+	var collections []*api.Collection
+
+	if len(cli.Flags.Collections) > 0 {
+		var err error
+		collections, err = resolveCollections(ctx, client, cli.Flags.Collections)
+		if err != nil {
+			return nil, err
+		}
+
+		collections = slices.DeleteFunc(collections, func(collection *api.Collection) bool {
+			if filter.collection(collection.Name) {
+				return false
 			}
+			slog.DebugContext(ctx, "skipping collection (excluded by filters)", "id", collection.ID, "name", collection.Name)
+			return true
+		})
 
-			// Replace any potentially unsupported characters with a dash.
-			parts[i] = reInvalid.ReplaceAllString(parts[i], "-")
-			// Clean up any double dashes.
-			parts[i] = reCleanDashes.ReplaceAllString(parts[i], "-")
-			// Remove any leading/trailing dashes.
-			parts[i] = strings.Trim(parts[i], "-")
+		if len(collections) == 0 {
+			return nil, errors.New("no collections left to export (all were excluded by --include-collection/--exclude-collection)")
 		}
+	}
 
-		// Join the parts back together.
-		name := filepath.Join(parts...)
+	// Resolve collection names in a stable order, so collisions are always
+	// resolved the same way.
+	resolver := newNameResolver(ctx)
+	for _, collection := range slices.SortedFunc(slices.Values(collections), compareCollectionIDs) {
+		resolver.Resolve("", collection.ID, collection.Name, false)
+	}
 
-		if len(cli.Flags.Filters) > 0 {
-			var matched bool
-			for _, filter := range cli.Flags.Filters {
-				matched, err = filepath.Match(filter, name)
-				if err != nil {
-					return fmt.Errorf("invalid filter pattern %q: %w", filter, err)
-				}
-				if matched {
-					break
-				}
+	var targets []*exportTarget
+
+	for i, format := range formats {
+		root := cli.Flags.ExportPath
+
+		if len(formats) > 1 {
+			root = filepath.Join(root, cli.Flags.Format[i])
+
+			if len(collections) == 0 && !cli.Flags.Extract {
+				root += ".zip"
 			}
+		}
 
-			if !matched {
-				slog.WarnContext(ctx, "skipping file/folder (does not match filter)", "path", name)
-				continue
+		if len(collections) == 0 {
+			targets = append(targets, &exportTarget{format: format, path: root})
+			continue
+		}
+
+		for _, collection := range collections {
+			name := resolver.Resolve("", collection.ID, collection.Name, false)
+			if name == "" {
+				name = collection.ID
+			}
+
+			if !cli.Flags.Extract {
+				name += ".zip"
 			}
+
+			targets = append(targets, &exportTarget{
+				collection: collection,
+				format:     format,
+				path:       filepath.Join(root, name),
+			})
 		}
+	}
+	return targets, nil
+}
 
-		inf, err := f.Open()
-		if err != nil {
-			return fmt.Errorf("failed to open file %q: %w", name, err)
+// resolveCollections resolves the provided collection references (IDs, url IDs,
+// or names) to collections. Names are matched case-insensitively, if there is no
+// exact match. Private collections are skipped when --exclude-private is set.
+func resolveCollections(ctx context.Context, client *api.Client, refs []string) ([]*api.Collection, error) {
+	var all []*api.Collection
+	var err error
+
+	for collection, lerr := range client.ListCollections(ctx) {
+		if lerr != nil {
+			return nil, fmt.Errorf("failed to list collections: %w", lerr)
 		}
+		all = append(all, collection)
+	}
+
+	resolved := make([]*api.Collection, 0, len(refs))
+	seen := make(map[string]bool, len(refs))
 
-		if f.FileInfo().IsDir() {
-			slog.InfoContext(ctx, "creating directory", "path", name)
+	for _, ref := range refs {
+		var match *api.Collection
+
+		for _, collection := range all {
+			if collection.ID == ref || collection.URLID == ref || collection.Name == ref {
+				match = collection
+				break
+			}
+		}
+
+		if match == nil {
+			for _, collection := range all {
+				if !strings.EqualFold(collection.Name, ref) {
+					continue
+				}
+
+				if match != nil {
+					return nil, fmt.Errorf("collection reference %q is ambiguous, use the collection ID instead", ref)
+				}
+				match = collection
+			}
+		}
 
-			err = os.MkdirAll(path.Join(cli.Flags.ExportPath, name), 0o700)
+		if match == nil {
+			// The collection may not be listed (e.g. archived collections), so try
+			// to look it up directly.
+			match, err = client.GetCollection(ctx, ref)
+			if api.IsNotFound(err) || api.IsForbidden(err) {
+				return nil, fmt.Errorf("collection %q not found (or not accessible with the provided token)", ref)
+			}
 			if err != nil {
-				_ = inf.Close()
-				return fmt.Errorf("failed to create directory %q: %w", name, err)
+				return nil, fmt.Errorf("failed to fetch collection %q: %w", ref, err)
 			}
+		}
 
-			_ = inf.Close()
+		if match.IsPrivate() && cli.Flags.ExcludePrivate {
+			slog.WarnContext(ctx, "skipping private collection (--exclude-private is set)", "id", match.ID, "name", match.Name)
 			continue
 		}
 
-		slog.InfoContext(ctx, "creating file", "path", name)
-		if err = os.MkdirAll(filepath.Dir(path.Join(cli.Flags.ExportPath, name)), 0o700); err != nil {
-			_ = inf.Close()
-			return fmt.Errorf("failed to create parent dirs for %q: %w", name, err)
+		if seen[match.ID] {
+			continue
 		}
-		outf, err := os.OpenFile(path.Join(cli.Flags.ExportPath, name), os.O_CREATE|os.O_WRONLY, 0o600)
+		seen[match.ID] = true
+		resolved = append(resolved, match)
+	}
+
+	if len(resolved) == 0 {
+		return nil, errors.New("no collections left to export")
+	}
+
+	return resolved, nil
+}
+
+// findExistingExports looks for an existing export for each target, based on the
+// --reuse policy. Exports must have been created within --reuse-max-age, match
+// the format and collection (if any) of the target, and not have failed or
+// expired. With the same-options policy, the export must also have been recorded
+// in the reuse state with the same options as the target. Targets without a
+// matching export are left as-is.
+func findExistingExports(ctx context.Context, client *api.Client, targets []*exportTarget, state *reuseState) error {
+	if cli.Flags.Reuse == reuseNever {
+		return nil
+	}
+
+	for op, err := range client.ListFileOperations(ctx) {
 		if err != nil {
-			_ = inf.Close()
-			return fmt.Errorf("failed to create file %q: %w", name, err)
+			return err
 		}
 
-		_, err = io.Copy(outf, inf)
-		if err != nil {
-			_ = inf.Close()
-			_ = outf.Close()
-			return fmt.Errorf("failed to copy file %q: %w", name, err)
+		if op.Type != api.FileOperationTypeExport || time.Since(op.CreatedAt) > cli.Flags.ReuseMaxAge {
+			continue
+		}
+
+		if op.State != api.FileOperationStateComplete && op.State != api.FileOperationStateCreating && op.State != api.FileOperationStateUploading {
+			continue
 		}
 
-		_ = inf.Close()
-		_ = outf.Close()
+		for _, target := range targets {
+			if target.operation != nil || op.Format != target.format || op.CollectionID != target.collectionID() {
+				continue
+			}
+
+			if cli.Flags.Reuse == reuseSameOptions && !state.matches(cli.Flags.URL, op, target.options()) {
+				continue
+			}
+
+			slog.InfoContext(ctx, "found existing export", "id", op.ID, "name", op.Name, "reuse", cli.Flags.Reuse)
+			target.operation = op
+			break
+		}
 	}
 	return nil
 }
+
+// waitForTargets waits for the file operations of all targets to complete,
+// concurrently.
+func waitForTargets(ctx context.Context, client *api.Client, targets []*exportTarget) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(targets))
+
+	for i, target := range targets {
+		wg.Go(func() {
+			tctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+			defer cancel()
+
+			op, err := client.WaitForFileOperation(tctx, target.operation.ID)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to wait for file operation %q (%s): %w", target.operation.ID, target.format, err)
+				return
+			}
+			target.operation = op
+		})
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Exit codes, used to distinguish between failure classes when ran from scripts
+// or schedulers.
+const (
+	exitCodeError        = 1
+	exitCodeUnauthorized = 3
+	exitCodeForbidden    = 4
+	exitCodeNotFound     = 5
+	exitCodeRateLimited  = 6
+)
+
+// fatal logs the error, with an actionable hint when the error is a known API
+// error, and exits with the exit code associated with the failure class.
+func fatal(logger *slog.Logger, msg string, err error) {
+	code := exitCodeError
+	var hint string
+
+	switch {
+	case api.IsUnauthorized(err):
+		code = exitCodeUnauthorized
+		hint = "token is missing, invalid, or expired"
+	case api.IsForbidden(err):
+		code = exitCodeForbidden
+		hint = "token lacks the permission/scope required for this request (e.g. export permission)"
+	case api.IsNotFound(err):
+		code = exitCodeNotFound
+		hint = "resource not found, or the token cannot access it"
+	case api.IsRateLimited(err):
+		code = exitCodeRateLimited
+		hint = "rate limited by the Outline server, try again later or lower the request rate"
+	}
+
+	if hint != "" {
+		logger.Error(msg, "error", err, "hint", hint)
+	} else {
+		logger.Error(msg, "error", err)
+	}
+
+	os.Exit(code)
+}
@@ -0,0 +1,223 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/lrstanley/clix/v2"
+	"github.com/lrstanley/outline-export/internal/api"
+)
+
+// parseFlags parses args like the command line, so all other flags have their
+// default values.
+func parseFlags(t *testing.T, args ...string) (*Flags, *kong.Context) {
+	t.Helper()
+
+	flags := &Flags{}
+
+	parser, err := kong.New(flags, kongVars(), kong.Exit(func(int) { t.Fatal("parser exited") }))
+	if err != nil {
+		t.Fatalf("failed to create parser: %v", err)
+	}
+
+	ctx, err := parser.Parse(args)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", args, err)
+	}
+	return flags, ctx
+}
+
+// setFlags parses args (see [parseFlags]), and uses the result as the global
+// flags for the duration of the test. Tests using it can't run in parallel.
+func setFlags(t *testing.T, args ...string) *Flags {
+	t.Helper()
+
+	flags, ctx := parseFlags(t, args...)
+
+	prev := cli
+	cli = &clix.CLI[Flags]{Context: ctx, Flags: flags}
+	t.Cleanup(func() { cli = prev })
+
+	return flags
+}
+
+// newTestServer returns a test server, which responds to each API path (e.g.
+// "/documents.list") with the value returned by the route, encoded as JSON.
+// Requests for other paths fail with a 404.
+func newTestServer(t *testing.T, routes map[string]func(body map[string]any) any) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := routes[r.URL.Path[len("/api"):]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(route(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// newTestClient returns a client for a test server (see [newTestServer]).
+func newTestClient(t *testing.T, routes map[string]func(body map[string]any) any) *api.Client {
+	t.Helper()
+
+	client, err := api.NewClient(&api.Config{
+		BaseURL: newTestServer(t, routes).URL,
+		Token:   "tok",
+		Retry:   &api.RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return client
+}
+
+func TestResolveTargets(t *testing.T) {
+	client := newTestClient(t, map[string]func(body map[string]any) any{
+		"/collections.list": func(map[string]any) any {
+			return map[string]any{"data": []map[string]any{
+				{"id": "c1", "urlId": "eng", "name": "Engineering", "permission": "read_write"},
+				{"id": "c2", "urlId": "des", "name": "Design", "permission": "read_write"},
+			}}
+		},
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string // "<format> <collection ID> <path>" of each target.
+		wantErr string
+	}{
+		{
+			name: "single-format",
+			args: []string{"--format", "markdown"},
+			want: []string{"outline-markdown  out"},
+		},
+		{
+			name: "multiple-formats",
+			args: []string{"--format", "markdown", "--format", "json"},
+			want: []string{"outline-markdown  out/markdown.zip", "json  out/json.zip"},
+		},
+		{
+			name: "multiple-formats-extract",
+			args: []string{"--format", "html,json", "--extract"},
+			want: []string{"html  out/html", "json  out/json"},
+		},
+		{
+			name: "collections",
+			args: []string{"--format", "markdown", "--collection", "Engineering", "--collection", "des"},
+			want: []string{"outline-markdown c1 out/Engineering.zip", "outline-markdown c2 out/Design.zip"},
+		},
+		{
+			name: "collections-multiple-formats-extract",
+			args: []string{"--format", "markdown,json", "--collection", "c1", "--extract"},
+			want: []string{"outline-markdown c1 out/markdown/Engineering", "json c1 out/json/Engineering"},
+		},
+		{
+			name: "collections-excluded",
+			args: []string{"--format", "markdown", "--collection", "c1", "--collection", "c2", "--exclude-collection", "Design"},
+			want: []string{"outline-markdown c1 out/Engineering.zip"},
+		},
+		{
+			name:    "collections-all-excluded",
+			args:    []string{"--format", "markdown", "--collection", "c2", "--include-collection", "Eng*"},
+			wantErr: "no collections left to export",
+		},
+		{
+			name:    "collection-not-found",
+			args:    []string{"--format", "markdown", "--collection", "missing"},
+			wantErr: `collection "missing" not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := setFlags(t, append([]string{"--export-path", "out"}, tt.args...)...)
+
+			formats := make([]api.ExportFormat, 0, len(flags.Format))
+			for _, name := range flags.Format {
+				formats = append(formats, exportFormats[name])
+			}
+
+			filter, err := newExportFilter(flags)
+			if err != nil {
+				t.Fatalf("newExportFilter() error = %v", err)
+			}
+
+			targets, err := resolveTargets(t.Context(), client, formats, filter)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("resolveTargets() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("resolveTargets() error = %v", err)
+			}
+
+			got := make([]string, 0, len(targets))
+			for _, target := range targets {
+				got = append(got, fmt.Sprintf("%s %s %s", target.format, target.collectionID(), filepath.ToSlash(target.path)))
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("resolveTargets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportTargetOptions(t *testing.T) {
+	setFlags(t, "--exclude-private", "--exclude-attachments")
+
+	collection := &api.Collection{ID: "c1"}
+
+	tests := []struct {
+		name   string
+		target *exportTarget
+		want   exportOptions
+	}{
+		{
+			name:   "workspace",
+			target: &exportTarget{format: api.ExportFormatJSON},
+			want:   exportOptions{Format: api.ExportFormatJSON},
+		},
+		{
+			// Private collections are only excluded from workspace exports.
+			name:   "collection",
+			target: &exportTarget{collection: collection, format: api.ExportFormatHTML},
+			want:   exportOptions{Format: api.ExportFormatHTML, CollectionID: "c1", IncludePrivate: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.options(); got != tt.want {
+				t.Errorf("options() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
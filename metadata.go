@@ -0,0 +1,127 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileMode is a permission mode, provided in octal (e.g. "0644").
+type fileMode os.FileMode
+
+func (m *fileMode) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseUint(strings.TrimSpace(string(text)), 8, 32)
+	if err != nil || v > 0o777 {
+		return fmt.Errorf("invalid mode %q (expected octal permissions, e.g. 0644)", string(text))
+	}
+
+	*m = fileMode(v)
+	return nil
+}
+
+func (m fileMode) String() string {
+	return fmt.Sprintf("%#o", uint32(m))
+}
+
+// metadataFS applies metadata to files. It's implemented by [os.Root], and by
+// [osFS] (for paths which aren't relative to a root).
+type metadataFS interface {
+	Chmod(name string, mode os.FileMode) error
+	Lchown(name string, uid, gid int) error
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// osFS implements [metadataFS] using the functions of the os package.
+type osFS struct{}
+
+func (osFS) Chmod(name string, mode os.FileMode) error         { return os.Chmod(name, mode) }
+func (osFS) Lchown(name string, uid, gid int) error            { return os.Lchown(name, uid, gid) }
+func (osFS) Chtimes(name string, atime, mtime time.Time) error { return os.Chtimes(name, atime, mtime) }
+
+// applyMetadata applies the --file-mode or --dir-mode, and --uid/--gid flags to
+// name, along with the modification time (if not zero).
+func applyMetadata(fsys metadataFS, name string, dir bool, modified time.Time) error {
+	mode := cli.Flags.FileMode
+	if dir {
+		mode = cli.Flags.DirMode
+	}
+
+	if err := fsys.Chmod(name, os.FileMode(mode)); err != nil {
+		return fmt.Errorf("failed to set mode of %q: %w", name, err)
+	}
+
+	if cli.Flags.UID >= 0 || cli.Flags.GID >= 0 {
+		if err := fsys.Lchown(name, cli.Flags.UID, cli.Flags.GID); err != nil {
+			return fmt.Errorf("failed to set owner of %q: %w", name, err)
+		}
+	}
+
+	if !modified.IsZero() {
+		if err := fsys.Chtimes(name, modified, modified); err != nil {
+			return fmt.Errorf("failed to set modification time of %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// dirTimes tracks the modification time of each directory of an export, which
+// is the latest modification time of anything within it.
+type dirTimes map[string]time.Time
+
+// add records a file or directory (relative to the export root) modified at t,
+// updating all of its parent directories (including the root, ".").
+func (d dirTimes) add(name string, dir bool, t time.Time) {
+	if !dir {
+		name = filepath.Dir(name)
+	}
+
+	for {
+		if t.After(d[name]) {
+			d[name] = t
+		} else if _, ok := d[name]; !ok {
+			d[name] = time.Time{}
+		}
+
+		if name == "." {
+			return
+		}
+		name = filepath.Dir(name)
+	}
+}
+
+// apply applies the directory metadata to all tracked directories. Deeper
+// directories are updated first, as changing the contents of a directory
+// changes its modification time.
+func (d dirTimes) apply(fsys metadataFS, root string) error {
+	dirs := make([]string, 0, len(d))
+	for dir := range d {
+		dirs = append(dirs, dir)
+	}
+
+	depth := func(dir string) int {
+		if dir == "." {
+			return -1
+		}
+		return strings.Count(dir, string(filepath.Separator))
+	}
+
+	slices.SortFunc(dirs, func(a, b string) int {
+		return cmp.Compare(depth(b), depth(a))
+	})
+
+	for _, dir := range dirs {
+		if err := applyMetadata(fsys, filepath.Join(root, dir), true, d[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
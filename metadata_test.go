@@ -0,0 +1,234 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFileMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text    string
+		want    fileMode
+		wantStr string
+		wantErr bool
+	}{
+		{text: "0644", want: 0o644, wantStr: "0644"},
+		{text: "755", want: 0o755, wantStr: "0755"},
+		{text: " 0600\n", want: 0o600, wantStr: "0600"},
+		{text: "0", want: 0, wantStr: "0"},
+		{text: "0777", want: 0o777, wantStr: "0777"},
+		{text: "1777", wantErr: true},
+		{text: "0800", wantErr: true},
+		{text: "rw-r--r--", wantErr: true},
+		{text: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			t.Parallel()
+
+			var got fileMode
+			err := got.UnmarshalText([]byte(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("UnmarshalText(%q) = %v, want an error", tt.text, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("UnmarshalText(%q) error = %v", tt.text, err)
+			}
+
+			if got != tt.want || got.String() != tt.wantStr {
+				t.Errorf("UnmarshalText(%q) = %v (%#o), want %v (%#o)", tt.text, got, uint32(got), tt.wantStr, uint32(tt.want))
+			}
+		})
+	}
+}
+
+func TestDirTimesAdd(t *testing.T) {
+	t.Parallel()
+
+	t1 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+
+	type entry struct {
+		name string
+		dir  bool
+		t    time.Time
+	}
+
+	tests := []struct {
+		name    string
+		entries []entry
+		want    dirTimes
+	}{
+		{
+			name:    "root-file",
+			entries: []entry{{name: "a.md", t: t1}},
+			want:    dirTimes{".": t1},
+		},
+		{
+			name: "nested",
+			entries: []entry{
+				{name: filepath.Join("a", "b", "c.md"), t: t1},
+				{name: filepath.Join("a", "d.md"), t: t3},
+				{name: filepath.Join("e", "f.md"), t: t2},
+			},
+			want: dirTimes{".": t3, "a": t3, filepath.Join("a", "b"): t1, "e": t2},
+		},
+		{
+			// Directories without a modification time are still tracked, so their
+			// metadata is applied.
+			name: "directories",
+			entries: []entry{
+				{name: "a", dir: true},
+				{name: filepath.Join("a", "b"), dir: true, t: t2},
+				{name: filepath.Join("a", "c"), dir: true},
+			},
+			want: dirTimes{".": t2, "a": t2, filepath.Join("a", "b"): t2, filepath.Join("a", "c"): {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := make(dirTimes)
+			for _, e := range tt.entries {
+				got.add(e.name, e.dir, e.t)
+			}
+
+			if !maps.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("add() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMetadata(t *testing.T) {
+	setFlags(
+		t,
+		"--file-mode", "0640",
+		"--dir-mode", "0750",
+		"--uid", strconv.Itoa(os.Getuid()),
+		"--gid", strconv.Itoa(os.Getgid()),
+	)
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"sub/a.md": "a"})
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatalf("failed to open root: %v", err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	modified := time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		fsys     metadataFS
+		path     string // Path passed to applyMetadata.
+		dir      bool
+		modified time.Time
+		wantMode os.FileMode
+	}{
+		{name: "root-file", fsys: root, path: filepath.Join("sub", "a.md"), modified: modified, wantMode: 0o640},
+		{name: "root-dir", fsys: root, path: "sub", dir: true, modified: modified, wantMode: 0o750},
+		{name: "os-file", fsys: osFS{}, path: filepath.Join(dir, "sub", "a.md"), wantMode: 0o640},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+
+			before, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("failed to stat %q: %v", path, err)
+			}
+
+			if err = applyMetadata(tt.fsys, tt.path, tt.dir, tt.modified); err != nil {
+				t.Fatalf("applyMetadata() error = %v", err)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("failed to stat %q: %v", path, err)
+			}
+
+			if got := info.Mode().Perm(); got != tt.wantMode {
+				t.Errorf("applyMetadata() mode = %v, want %v", got, tt.wantMode)
+			}
+
+			// A zero modification time leaves it unchanged.
+			want := tt.modified
+			if want.IsZero() {
+				want = before.ModTime()
+			}
+
+			if !info.ModTime().Equal(want) {
+				t.Errorf("applyMetadata() modification time = %v, want %v", info.ModTime(), want)
+			}
+		})
+	}
+
+	if err = applyMetadata(root, "missing.md", false, modified); err == nil {
+		t.Error("applyMetadata() error = nil for a missing file")
+	}
+}
+
+func TestDirTimesApply(t *testing.T) {
+	setFlags(t, "--dir-mode", "0750")
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		filepath.Join("a", "b", "c.md"): "c",
+		filepath.Join("a", "d.md"):      "d",
+	})
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatalf("failed to open root: %v", err)
+	}
+	t.Cleanup(func() { _ = root.Close() })
+
+	t1 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	times := make(dirTimes)
+	times.add(filepath.Join("a", "b", "c.md"), false, t1)
+	times.add(filepath.Join("a", "d.md"), false, t2)
+
+	if err = times.apply(root, ""); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+
+	// Parents are updated after their children, so their times aren't changed
+	// again by updating the children.
+	for name, want := range map[string]time.Time{".": t2, "a": t2, filepath.Join("a", "b"): t1} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("failed to stat %q: %v", name, err)
+		}
+
+		if !info.ModTime().Equal(want) || info.Mode().Perm() != 0o750 {
+			t.Errorf("apply() set %q to %v (%v), want %v (-rwxr-x---)", name, info.ModTime(), info.Mode().Perm(), want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/notify"
+)
+
+// notifyTimeout is the maximum time spent sending notifications for a run.
+const notifyTimeout = 30 * time.Second
+
+// notifyData is the data passed to notification templates, and included in
+// generic webhook payloads.
+type notifyData struct {
+	Event           notify.Event  `json:"event"`
+	Result          *runResult    `json:"result"`
+	Error           string        `json:"error,omitempty"`
+	StartedAt       time.Time     `json:"started_at"`
+	Duration        time.Duration `json:"-"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Hostname        string        `json:"hostname"`
+}
+
+// runNotifier sends notifications about export runs, based on the --notify-*
+// flags.
+type runNotifier struct {
+	notifiers []notify.Notifier
+	tmpl      *notify.Template
+	events    []notify.Event
+}
+
+// newRunNotifier returns a notifier based on the --notify-* flags, or nil if no
+// notification URLs are configured.
+func newRunNotifier() (*runNotifier, error) {
+	if len(cli.Flags.NotifyURL) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	n := &runNotifier{}
+
+	for _, u := range cli.Flags.NotifyURL {
+		notifier, err := notify.Parse(u, nil)
+		if err != nil {
+			return nil, err
+		}
+		n.notifiers = append(n.notifiers, notifier)
+	}
+
+	for _, event := range cli.Flags.NotifyOn {
+		n.events = append(n.events, notify.Event(event))
+	}
+
+	var err error
+	n.tmpl, err = notify.LoadTemplate(cli.Flags.NotifyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// notify sends a notification for the run, if the resulting event is enabled.
+// Failures to notify are logged, and don't affect the result of the run.
+func (n *runNotifier) notify(ctx context.Context, logger *slog.Logger, start time.Time, result *runResult, err error) {
+	if n == nil {
+		return
+	}
+
+	event, ok := notify.Select(n.events, err != nil, result != nil && result.Changes > 0)
+	if !ok {
+		return
+	}
+
+	data := &notifyData{
+		Event:     event,
+		Result:    result,
+		StartedAt: start,
+		Duration:  time.Since(start),
+	}
+	data.DurationSeconds = data.Duration.Seconds()
+	data.Hostname, _ = os.Hostname()
+
+	if data.Result == nil {
+		data.Result = &runResult{Mode: cli.Flags.Mode, Formats: cli.Flags.Format, Path: cli.Flags.ExportPath}
+	}
+
+	if err != nil {
+		data.Error = err.Error()
+	}
+
+	msg, rerr := n.tmpl.Render(event, data)
+	if rerr != nil {
+		logger.ErrorContext(ctx, "failed to render notification", "error", rerr)
+		return
+	}
+
+	// Use a separate context, so failure notifications are still sent when the
+	// run was canceled.
+	nctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	defer cancel()
+
+	if serr := notify.Send(nctx, n.notifiers, msg); serr != nil {
+		logger.ErrorContext(ctx, "failed to send notification", "event", event, "error", serr)
+		return
+	}
+
+	logger.InfoContext(ctx, "notification sent", "event", event, "targets", fmt.Sprint(n.notifiers))
+}
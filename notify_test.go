@@ -0,0 +1,118 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunNotifier(t *testing.T) {
+	tests := []struct {
+		name        string
+		notifyOn    string
+		result      *runResult
+		err         error
+		wantEvent   string // Empty if no notification should be sent.
+		wantSubject string
+		wantText    string // Substring of the text.
+	}{
+		{
+			name:        "failure-without-result",
+			notifyOn:    "failure",
+			err:         errors.New("boom"),
+			wantEvent:   "failure",
+			wantSubject: "outline-export failure: markdown export failed",
+			wantText:    "Error: boom\n",
+		},
+		{
+			name:     "success-not-enabled",
+			notifyOn: "failure",
+			result:   &runResult{Job: "wiki/nightly", Mode: modeFileOperation, Formats: []string{"markdown"}},
+		},
+		{
+			name:        "change",
+			notifyOn:    "success,change",
+			result:      &runResult{Job: "wiki/nightly", Mode: modeFileOperation, Formats: []string{"markdown", "json"}, Changes: 2},
+			wantEvent:   "change",
+			wantSubject: "outline-export change: wiki/nightly markdown/json export completed",
+			wantText:    "Files: 0 written, 0 skipped, 2 changed\n",
+		},
+		{
+			name:        "success",
+			notifyOn:    "success,change",
+			result:      &runResult{Mode: modeFileOperation, Formats: []string{"html"}, FilesExtracted: 5},
+			wantEvent:   "success",
+			wantSubject: "outline-export success: html export completed",
+			wantText:    "Files: 5 written, 0 skipped, 0 changed\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payloads []map[string]any
+
+			srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				var payload map[string]any
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("failed to decode payload: %v", err)
+				}
+				payloads = append(payloads, payload)
+			}))
+			t.Cleanup(srv.Close)
+
+			setFlags(t, "--notify-url", srv.URL, "--notify-on", tt.notifyOn, "--format", "markdown")
+
+			n, err := newRunNotifier()
+			if err != nil {
+				t.Fatalf("newRunNotifier() error = %v", err)
+			}
+
+			n.notify(t.Context(), slog.New(slog.DiscardHandler), time.Now(), tt.result, tt.err)
+
+			if tt.wantEvent == "" {
+				if len(payloads) != 0 {
+					t.Errorf("notify() sent %v, want no notification", payloads)
+				}
+				return
+			}
+
+			if len(payloads) != 1 {
+				t.Fatalf("notify() sent %d notifications, want 1", len(payloads))
+			}
+
+			got := payloads[0]
+			if got["event"] != tt.wantEvent || got["subject"] != tt.wantSubject {
+				t.Errorf("notify() sent event %q with subject %q, want %q with %q", got["event"], got["subject"], tt.wantEvent, tt.wantSubject)
+			}
+
+			if text, _ := got["text"].(string); !strings.Contains(text, tt.wantText) {
+				t.Errorf("notify() sent text %q, want it to contain %q", text, tt.wantText)
+			}
+
+			if data, _ := got["data"].(map[string]any); data == nil || data["result"] == nil || data["hostname"] == nil {
+				t.Errorf("notify() sent data %v, want the run result and hostname", got["data"])
+			}
+		})
+	}
+}
+
+func TestRunNotifierDisabled(t *testing.T) {
+	setFlags(t)
+
+	n, err := newRunNotifier()
+	if err != nil || n != nil {
+		t.Fatalf("newRunNotifier() = (%v, %v), want (nil, nil) without --notify-url", n, err)
+	}
+
+	// A nil notifier is a no-op.
+	n.notify(t.Context(), slog.New(slog.DiscardHandler), time.Now(), nil, errors.New("boom"))
+}
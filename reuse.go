@@ -0,0 +1,165 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+)
+
+const (
+	// reuseNever always generates a new export.
+	reuseNever = "never"
+	// reuseSameOptions only reuses exports which were generated by this tool, with
+	// the same options as the current run.
+	reuseSameOptions = "same-options"
+	// reuseAny reuses any export with the same format and collection, regardless of
+	// who generated it, or which options it was generated with.
+	reuseAny = "any"
+
+	// reuseStateFile is the name of the file (within the user cache directory)
+	// which records the options exports were generated with.
+	reuseStateFile = "exports.json"
+
+	// reuseStateRetention is the minimum time exports are kept in the reuse state.
+	// Outline expires exports well before this.
+	reuseStateRetention = 24 * time.Hour
+)
+
+// exportOptions are the options an export was requested with. Outline doesn't
+// return these with file operations, so they're recorded locally.
+type exportOptions struct {
+	Format             api.ExportFormat `json:"format"`
+	CollectionID       string           `json:"collectionId,omitempty"`
+	IncludeAttachments bool             `json:"includeAttachments"`
+	IncludePrivate     bool             `json:"includePrivate"`
+}
+
+type reuseStateEntry struct {
+	URL       string    `json:"url"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	exportOptions
+}
+
+// reuseState tracks the exports generated by this tool, and the options they
+// were generated with, so only exports with matching options are reused. A nil
+// state matches no exports, and records nothing.
+type reuseState struct {
+	path string
+
+	Exports map[string]*reuseStateEntry `json:"exports"`
+}
+
+// defaultReuseStatePath returns the default path of the reuse state file.
+func defaultReuseStatePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve cache directory (use --reuse-state-file): %w", err)
+	}
+	return filepath.Join(dir, "outline-export", reuseStateFile), nil
+}
+
+// loadReuseState loads the reuse state from path (or the default path, if empty).
+// If no state exists yet, an empty state is returned.
+func loadReuseState(path string) (*reuseState, error) {
+	if path == "" {
+		var err error
+		path, err = defaultReuseStatePath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state := &reuseState{
+		path:    path,
+		Exports: make(map[string]*reuseStateEntry),
+	}
+
+	b, err := os.ReadFile(state.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reuse state file %q: %w", state.path, err)
+	}
+
+	if err = json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("failed to decode reuse state file %q: %w", state.path, err)
+	}
+
+	if state.Exports == nil {
+		state.Exports = make(map[string]*reuseStateEntry)
+	}
+	return state, nil
+}
+
+// matches returns true if the export was generated by this tool, against the
+// same Outline instance, with the provided options.
+func (s *reuseState) matches(url string, op *api.FileOperation, opts exportOptions) bool {
+	if s == nil {
+		return false
+	}
+
+	entry, ok := s.Exports[op.ID]
+	return ok && entry.URL == url && entry.exportOptions == opts
+}
+
+// record records the options an export was generated with.
+func (s *reuseState) record(url string, op *api.FileOperation, opts exportOptions) {
+	if s == nil {
+		return
+	}
+
+	s.Exports[op.ID] = &reuseStateEntry{
+		URL:           url,
+		ID:            op.ID,
+		CreatedAt:     op.CreatedAt,
+		exportOptions: opts,
+	}
+}
+
+// remove removes an export (e.g. once it has been deleted).
+func (s *reuseState) remove(id string) {
+	if s == nil {
+		return
+	}
+
+	delete(s.Exports, id)
+}
+
+// save prunes exports older than maxAge (or the retention period, whichever is
+// longer), and atomically writes the state to disk.
+func (s *reuseState) save(maxAge time.Duration) error {
+	if s == nil {
+		return nil
+	}
+
+	maxAge = max(maxAge, reuseStateRetention)
+
+	for id, entry := range s.Exports {
+		if time.Since(entry.CreatedAt) > maxAge {
+			delete(s.Exports, id)
+		}
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode reuse state: %w", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create reuse state directory: %w", err)
+	}
+
+	return writeFileAtomic(s.path, b, 0o600)
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/api"
+)
+
+func TestReuseStateMatches(t *testing.T) {
+	t.Parallel()
+
+	opts := exportOptions{Format: api.ExportFormatMarkdown, CollectionID: "c1", IncludeAttachments: true}
+	op := &api.FileOperation{ID: "op1", CreatedAt: time.Now()}
+
+	state := &reuseState{Exports: make(map[string]*reuseStateEntry)}
+	state.record("https://wiki.example.com", op, opts)
+
+	otherFormat := opts
+	otherFormat.Format = api.ExportFormatJSON
+	otherCollection := opts
+	otherCollection.CollectionID = ""
+	withPrivate := opts
+	withPrivate.IncludePrivate = true
+
+	tests := []struct {
+		name  string
+		state *reuseState
+		url   string
+		op    *api.FileOperation
+		opts  exportOptions
+		want  bool
+	}{
+		{name: "same", state: state, url: "https://wiki.example.com", op: op, opts: opts, want: true},
+		{name: "other-url", state: state, url: "https://docs.example.com", op: op, opts: opts},
+		{name: "not-recorded", state: state, url: "https://wiki.example.com", op: &api.FileOperation{ID: "op2"}, opts: opts},
+		{name: "other-format", state: state, url: "https://wiki.example.com", op: op, opts: otherFormat},
+		{name: "other-collection", state: state, url: "https://wiki.example.com", op: op, opts: otherCollection},
+		{name: "other-private", state: state, url: "https://wiki.example.com", op: op, opts: withPrivate},
+		{name: "nil", url: "https://wiki.example.com", op: op, opts: opts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.state.matches(tt.url, tt.op, tt.opts); got != tt.want {
+				t.Errorf("matches(%q, %q, %+v) = %t, want %t", tt.url, tt.op.ID, tt.opts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReuseStateSave(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		ages   map[string]time.Duration // Age of each recorded export, by ID.
+		remove []string
+		want   []string // IDs of the exports which are loaded back.
+	}{
+		{
+			name:   "retention",
+			maxAge: time.Hour,
+			ages:   map[string]time.Duration{"new": time.Minute, "hours": 12 * time.Hour, "days": 48 * time.Hour},
+			want:   []string{"hours", "new"},
+		},
+		{
+			name:   "max-age",
+			maxAge: 72 * time.Hour,
+			ages:   map[string]time.Duration{"new": time.Minute, "days": 48 * time.Hour, "week": 7 * 24 * time.Hour},
+			want:   []string{"days", "new"},
+		},
+		{
+			name:   "removed",
+			maxAge: time.Hour,
+			ages:   map[string]time.Duration{"new": time.Minute, "deleted": time.Minute},
+			remove: []string{"deleted", "missing"},
+			want:   []string{"new"},
+		},
+		{
+			name:   "empty",
+			maxAge: time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "cache", reuseStateFile)
+
+			state, err := loadReuseState(path)
+			if err != nil {
+				t.Fatalf("loadReuseState() error = %v", err)
+			}
+
+			if len(state.Exports) != 0 {
+				t.Fatalf("loadReuseState() = %v, want an empty state", state.Exports)
+			}
+
+			opts := exportOptions{Format: api.ExportFormatHTML, IncludeAttachments: true}
+			for id, age := range tt.ages {
+				state.record("https://wiki.example.com", &api.FileOperation{ID: id, CreatedAt: now.Add(-age)}, opts)
+			}
+
+			for _, id := range tt.remove {
+				state.remove(id)
+			}
+
+			if err = state.save(tt.maxAge); err != nil {
+				t.Fatalf("save() error = %v", err)
+			}
+
+			loaded, err := loadReuseState(path)
+			if err != nil {
+				t.Fatalf("loadReuseState() error = %v", err)
+			}
+
+			if got := slices.Sorted(maps.Keys(loaded.Exports)); !slices.Equal(got, tt.want) {
+				t.Errorf("loadReuseState() after save = %q, want %q", got, tt.want)
+			}
+
+			for _, id := range tt.want {
+				op := &api.FileOperation{ID: id}
+				if !loaded.matches("https://wiki.example.com", op, opts) {
+					t.Errorf("loaded state doesn't match export %q with its recorded options: %+v", id, loaded.Exports[id])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadReuseStateInvalid(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  bool
+	}{
+		{name: "null-exports", contents: `{"exports": null}`},
+		{name: "invalid", contents: `{"exports": [`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatalf("failed to write state: %v", err)
+			}
+
+			state, err := loadReuseState(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadReuseState() = %+v, want an error", state)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("loadReuseState() error = %v", err)
+			}
+
+			// Exports can be recorded, even if the file didn't contain any.
+			state.record("https://wiki.example.com", &api.FileOperation{ID: "op1"}, exportOptions{})
+			if len(state.Exports) != 1 {
+				t.Errorf("record() on loaded state = %v, want 1 export", state.Exports)
+			}
+		})
+	}
+}
+
+func TestReuseStateNil(t *testing.T) {
+	t.Parallel()
+
+	var state *reuseState
+
+	op := &api.FileOperation{ID: "op1"}
+	state.record("https://wiki.example.com", op, exportOptions{})
+	state.remove(op.ID)
+
+	if state.matches("https://wiki.example.com", op, exportOptions{}) {
+		t.Error("matches() = true for a nil state")
+	}
+
+	if err := state.save(time.Hour); err != nil {
+		t.Errorf("save() error = %v for a nil state", err)
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/lrstanley/outline-export/internal/sanitize"
+)
+
+// newNameResolver returns a resolver which sanitizes names using the --sanitize
+// strategy, and logs resolved collisions.
+func newNameResolver(ctx context.Context) *sanitize.Resolver {
+	r := sanitize.NewResolver(cli.Flags.Sanitize)
+	r.OnCollision = func(name, resolved string) {
+		slog.WarnContext(ctx, "resolved name collision", "name", name, "resolved", resolved)
+	}
+	return r
+}
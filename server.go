@@ -0,0 +1,165 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/metrics"
+	"github.com/lrstanley/outline-export/internal/scheduler"
+)
+
+// statusRun is a single run, as returned by the /status endpoint.
+type statusRun struct {
+	ID         int          `json:"id"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at,omitzero"`
+	Duration   float64      `json:"duration_seconds"`
+	Running    bool         `json:"running"`
+	Results    []*runResult `json:"results"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// statusResponse is the response of the /status endpoint.
+type statusResponse struct {
+	Ready       bool        `json:"ready"`
+	Running     bool        `json:"running"`
+	StartedAt   time.Time   `json:"started_at"`
+	LastSuccess time.Time   `json:"last_success,omitzero"`
+	ReadyMaxAge float64     `json:"ready_max_age_seconds"`
+	Runs        []statusRun `json:"runs"`
+}
+
+// statusServer serves health, readiness, status and metrics endpoints for the
+// daemon.
+type statusServer struct {
+	logger      *slog.Logger
+	sched       *scheduler.Scheduler[[]*runResult]
+	readyMaxAge time.Duration
+}
+
+// newStatusServer returns a status server for the provided scheduler. /readyz
+// fails if the last successful run is older than readyMaxAge.
+func newStatusServer(logger *slog.Logger, sched *scheduler.Scheduler[[]*runResult], readyMaxAge time.Duration) *statusServer {
+	return &statusServer{
+		logger:      logger,
+		sched:       sched,
+		readyMaxAge: readyMaxAge,
+	}
+}
+
+// ready returns nil if the last successful run is recent enough. Before the first
+// successful run, the daemon start time is used instead, so the daemon has time
+// to complete its first export.
+func (s *statusServer) ready() error {
+	last := s.sched.LastSuccess()
+	if last.IsZero() {
+		last = s.sched.StartedAt()
+	}
+
+	if age := time.Since(last); age > s.readyMaxAge {
+		return fmt.Errorf(
+			"last successful export was %s ago (max %s)",
+			age.Round(time.Second), s.readyMaxAge,
+		)
+	}
+	return nil
+}
+
+// handler returns the http handler for all status endpoints.
+func (s *statusServer) handler() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		if err := s.ready(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(err.Error() + "\n"))
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		history := s.sched.History()
+
+		resp := statusResponse{
+			Ready:       s.ready() == nil,
+			Running:     s.sched.Running(),
+			StartedAt:   s.sched.StartedAt(),
+			LastSuccess: s.sched.LastSuccess(),
+			ReadyMaxAge: s.readyMaxAge.Seconds(),
+			Runs:        make([]statusRun, 0, len(history)),
+		}
+
+		for _, run := range history {
+			resp.Runs = append(resp.Runs, statusRun{
+				ID:         run.ID,
+				StartedAt:  run.StartedAt,
+				FinishedAt: run.FinishedAt,
+				Duration:   run.Duration().Seconds(),
+				Running:    run.FinishedAt.IsZero(),
+				Results:    run.Result,
+				Error:      run.Error,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			s.logger.WarnContext(r.Context(), "failed to write status response", "error", err)
+		}
+	})
+
+	return mux
+}
+
+// serve serves the status endpoints on the provided address, until the context
+// is canceled.
+func (s *statusServer) serve(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %q: %w", addr, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+
+		_ = srv.Shutdown(shutdownCtx) //nolint:contextcheck
+	}()
+
+	s.logger.InfoContext(ctx, "status server listening", "addr", ln.Addr().String())
+
+	if err = srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("status server failed: %w", err)
+	}
+	return nil
+}
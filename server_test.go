@@ -0,0 +1,130 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/outline-export/internal/scheduler"
+	"github.com/robfig/cron/v3"
+)
+
+func TestStatusServer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		runs     []error // Result of each run, in order.
+		path     string
+		wantCode int
+		wantBody string // Substring of the body.
+	}{
+		{name: "healthz", path: "/healthz", wantCode: http.StatusOK, wantBody: "ok"},
+		{name: "readyz-no-runs", path: "/readyz", wantCode: http.StatusServiceUnavailable, wantBody: "last successful export was"},
+		{name: "readyz-success", runs: []error{nil}, path: "/readyz", wantCode: http.StatusOK, wantBody: "ok"},
+		{
+			name:     "readyz-failed-after-success",
+			runs:     []error{nil, errors.New("boom")},
+			path:     "/readyz",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{name: "readyz-failed", runs: []error{errors.New("boom")}, path: "/readyz", wantCode: http.StatusServiceUnavailable},
+		{name: "metrics", path: "/metrics", wantCode: http.StatusOK, wantBody: "# HELP"},
+		{name: "unknown", path: "/unknown", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int
+			sched := scheduler.New(&scheduler.Options{
+				Schedule: cron.Every(time.Hour),
+				Logger:   slog.New(slog.DiscardHandler),
+			}, func(context.Context) ([]*runResult, error) {
+				calls++
+				return nil, tt.runs[calls-1]
+			})
+
+			for range tt.runs {
+				sched.TryRun(t.Context())
+			}
+
+			srv := newStatusServer(slog.New(slog.DiscardHandler), sched, time.Hour)
+
+			rec := httptest.NewRecorder()
+			srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, http.NoBody))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.wantCode)
+			}
+
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("GET %s = %q, want it to contain %q", tt.path, rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestStatusServerStatus(t *testing.T) {
+	t.Parallel()
+
+	results := []*runResult{{Job: "wiki/nightly", Mode: modeFileOperation, FilesExtracted: 3}}
+
+	var calls int
+	sched := scheduler.New(&scheduler.Options{
+		Schedule: cron.Every(time.Hour),
+		Logger:   slog.New(slog.DiscardHandler),
+	}, func(context.Context) ([]*runResult, error) {
+		calls++
+		if calls == 2 {
+			return nil, errors.New("boom")
+		}
+		return results, nil
+	})
+
+	sched.TryRun(t.Context())
+	sched.TryRun(t.Context())
+
+	srv := newStatusServer(slog.New(slog.DiscardHandler), sched, time.Hour)
+
+	rec := httptest.NewRecorder()
+	srv.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", http.NoBody))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var resp statusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode status response: %v", err)
+	}
+
+	if !resp.Ready || resp.Running || resp.LastSuccess.IsZero() || resp.ReadyMaxAge != time.Hour.Seconds() {
+		t.Errorf("GET /status = %+v, want a ready, idle daemon", resp)
+	}
+
+	// Newest first.
+	if len(resp.Runs) != 2 {
+		t.Fatalf("GET /status returned %d runs, want 2", len(resp.Runs))
+	}
+
+	if run := resp.Runs[0]; run.ID != 2 || run.Error != "boom" || run.Running || len(run.Results) != 0 {
+		t.Errorf("runs[0] = %+v, want failed run 2", run)
+	}
+
+	if run := resp.Runs[1]; run.ID != 1 || run.Error != "" || len(run.Results) != 1 || run.Results[0].Job != "wiki/nightly" {
+		t.Errorf("runs[1] = %+v, want successful run 1 with its results", run)
+	}
+}
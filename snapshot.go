@@ -0,0 +1,35 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/lrstanley/outline-export/internal/snapshot"
+)
+
+// completeSnapshot moves the partial snapshot into place, points the latest
+// symlink at it, and prunes old snapshots based on the retention flags.
+func completeSnapshot(ctx context.Context, root, name string, result *runResult) error {
+	s, err := snapshot.Complete(root, name)
+	if err != nil {
+		return err
+	}
+	result.Path = filepath.Join(root, name)
+	slog.InfoContext(ctx, "snapshot completed", "path", s.Path)
+
+	removed, err := snapshot.Prune(root, snapshot.Retention{
+		KeepLast:    cli.Flags.KeepLast,
+		KeepDaily:   cli.Flags.KeepDaily,
+		KeepWeekly:  cli.Flags.KeepWeekly,
+		KeepMonthly: cli.Flags.KeepMonthly,
+	})
+	for _, s := range removed {
+		slog.InfoContext(ctx, "pruned snapshot", "path", s.Path)
+	}
+	return err
+}
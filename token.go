@@ -0,0 +1,79 @@
+// Copyright (c) Liam Stanley <liam@liam.sh>. All rights reserved. Use of
+// this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// tokenCommandTimeout is the maximum time the --token-command helper can take.
+const tokenCommandTimeout = 30 * time.Second
+
+// resolveToken returns the token from the configured token source. Token files
+// and commands are resolved on each call, so tokens can be rotated without
+// restarting the daemon.
+func resolveToken(ctx context.Context) (string, error) {
+	switch {
+	case cli.Flags.TokenFile != "":
+		data, err := os.ReadFile(cli.Flags.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file: %w", err)
+		}
+
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %q is empty", cli.Flags.TokenFile)
+		}
+		return token, nil
+	case cli.Flags.TokenCommand != "":
+		return runTokenCommand(ctx, cli.Flags.TokenCommand)
+	default:
+		return cli.Flags.Token, nil
+	}
+}
+
+// runTokenCommand runs the command through the system shell, and returns the
+// token from its stdout. stderr is included in the error if the command fails,
+// but stdout never is, as it may contain the token.
+func runTokenCommand(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, tokenCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("failed to run token command: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("failed to run token command: %w", err)
+	}
+
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return "", errors.New("token command returned an empty token")
+	}
+
+	if strings.ContainsAny(token, "\r\n") {
+		return "", errors.New("token command returned multiple lines")
+	}
+	return token, nil
+}